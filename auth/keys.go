@@ -0,0 +1,550 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Keys are reloaded from the database when they are older than
+// keyReloadInterval, so a rotation or retirement by another instance is picked
+// up quickly. A token with an unknown kid forces a reload, but not more often
+// than unknownKeyReloadInterval.
+const (
+	keyReloadInterval        = 30 * time.Second
+	unknownKeyReloadInterval = 5 * time.Second
+)
+
+// JWKSMaxAge is how long clients may cache the published JWKS
+const JWKSMaxAge = 5 * time.Minute
+
+// A new key is published this long before it signs, so every JWKS cached by a
+// verifier has expired by the time tokens carry its kid. Instances serve the
+// key after their next reload, hence the reload interval on top.
+const keyPublishDelay = JWKSMaxAge + keyReloadInterval
+
+// Prefix of private keys encrypted with the key-encryption key. Keys stored by
+// earlier versions are plain PEM and get encrypted on start.
+const encryptedKeyPrefix = "v1:"
+
+// Arbitrary number identifying the rotation lock between instances
+const keyRotationLockID = 4510451
+
+type signingKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.PrivateKey
+	Public    crypto.PublicKey
+	CreatedAt time.Time
+	RetiredAt *time.Time
+}
+
+// KeyStore signs and verifies access tokens. With an asymmetric algorithm
+// (RS256, ES256 or EdDSA) the keys live in the signing_keys table, shared by
+// all instances and encrypted with AES-GCM under the key-encryption key: the
+// newest key published for keyPublishDelay signs and every key that has not
+// passed its grace period verifies. With HS256 the shared secret is used.
+type KeyStore struct {
+	db        *sql.DB
+	algorithm string
+	secret    []byte
+	kek       cipher.AEAD
+	rotation  time.Duration
+	grace     time.Duration
+
+	reloadMu sync.Mutex
+	mu       sync.RWMutex
+	signers  []*signingKey // keys not retired, newest first
+	keys     map[string]*signingKey
+	loadedAt time.Time
+}
+
+// NewKeyStore loads the signing keys, creating the first one if needed. A
+// key of another algorithm than the configured one is rotated out right away.
+// encryptionKey is the base64 encoded 32 byte key-encryption key, required
+// for the asymmetric algorithms.
+func NewKeyStore(db *sql.DB, algorithm, secret, encryptionKey string, rotation, grace time.Duration) (*KeyStore, error) {
+	s := &KeyStore{
+		db:        db,
+		algorithm: algorithm,
+		secret:    []byte(secret),
+		rotation:  rotation,
+		grace:     grace,
+	}
+
+	switch algorithm {
+	case "HS256":
+		return s, nil
+	case "RS256", "ES256", "EdDSA":
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+	}
+
+	kek, err := newKeyEncryptionCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	s.kek = kek
+
+	if err := s.encryptStoredKeys(); err != nil {
+		return nil, err
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	if len(s.signers) == 0 || s.signers[0].Algorithm != algorithm {
+		if err := s.rotate(false); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Algorithms returns the JWT algorithms tokens may be signed with
+func (s *KeyStore) Algorithms() []string {
+	return []string{s.algorithm}
+}
+
+// Sign signs claims with the current key and sets its kid in the header
+func (s *KeyStore) Sign(claims jwt.Claims) (string, error) {
+	if s.algorithm == "HS256" {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+
+	if err := s.reloadIfOlderThan(keyReloadInterval); err != nil {
+		return "", err
+	}
+
+	key := s.currentSigner(time.Now())
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc returns the verification key for token, chosen by its kid
+func (s *KeyStore) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if s.algorithm == "HS256" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return s.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, err := s.verificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys that currently verify tokens
+func (s *KeyStore) JWKS() (JWKSet, error) {
+	set := JWKSet{Keys: []JWK{}}
+	if s.algorithm == "HS256" {
+		return set, nil
+	}
+
+	if err := s.reloadIfOlderThan(keyReloadInterval); err != nil {
+		return set, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.RetiredAt != nil && time.Since(*key.RetiredAt) > s.grace {
+			continue
+		}
+		jwk, err := NewJWK(key.ID, key.Algorithm, key.Public)
+		if err != nil {
+			return set, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// RunRotation checks every interval whether the active key is older than the
+// rotation period and replaces it, and drops keys past their grace period. It
+// never returns.
+func (s *KeyStore) RunRotation(interval time.Duration) {
+	if s.algorithm == "HS256" {
+		return
+	}
+
+	for range time.Tick(interval) {
+		if err := s.rotate(true); err != nil {
+			log.Println("Signing key rotation failed:", err)
+		}
+	}
+}
+
+// currentSigner returns the newest key published for keyPublishDelay. Until
+// one is, the oldest key signs: the first key, or the first of a new
+// algorithm, has no predecessor to wait with.
+func (s *KeyStore) currentSigner(now time.Time) *signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.signers {
+		if now.Sub(key.CreatedAt) >= keyPublishDelay {
+			return key
+		}
+	}
+	if len(s.signers) == 0 {
+		return nil
+	}
+	return s.signers[len(s.signers)-1]
+}
+
+// verificationKey returns the key with kid unless it has passed its grace
+// period. Stale keys are looked up in the database again, and so are unknown
+// kids, at most every unknownKeyReloadInterval.
+func (s *KeyStore) verificationKey(kid string) (*signingKey, error) {
+	if err := s.reloadIfOlderThan(keyReloadInterval); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+
+	if !ok {
+		if err := s.reloadIfOlderThan(unknownKeyReloadInterval); err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		key, ok = s.keys[kid]
+		s.mu.RUnlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.RetiredAt != nil && time.Since(*key.RetiredAt) > s.grace {
+		return nil, fmt.Errorf("signing key %q has been retired", kid)
+	}
+	return key, nil
+}
+
+// reloadIfOlderThan reloads the keys when they were loaded longer than maxAge
+// ago. Concurrent callers wait for a single reload.
+func (s *KeyStore) reloadIfOlderThan(maxAge time.Duration) error {
+	s.mu.RLock()
+	stale := time.Since(s.loadedAt) > maxAge
+	s.mu.RUnlock()
+	if !stale {
+		return nil
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.RLock()
+	stale = time.Since(s.loadedAt) > maxAge
+	s.mu.RUnlock()
+	if !stale {
+		return nil
+	}
+	return s.reload()
+}
+
+// reload reads the keys that are active or within their grace period
+func (s *KeyStore) reload() error {
+	rows, err := s.db.Query(`
+		SELECT kid, algorithm, private_key, created_at, retired_at
+		FROM signing_keys
+		WHERE retired_at IS NULL OR retired_at > $1
+		ORDER BY created_at DESC
+	`, time.Now().Add(-s.grace).UTC())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := map[string]*signingKey{}
+	var signers []*signingKey
+	for rows.Next() {
+		var (
+			key    signingKey
+			stored string
+		)
+		if err := rows.Scan(&key.ID, &key.Algorithm, &stored, &key.CreatedAt, &key.RetiredAt); err != nil {
+			return err
+		}
+
+		privatePEM, err := s.decryptPrivateKey(key.ID, stored)
+		if err != nil {
+			return err
+		}
+
+		block, _ := pem.Decode([]byte(privatePEM))
+		if block == nil {
+			return fmt.Errorf("signing key %s is not valid PEM", key.ID)
+		}
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", key.ID, err)
+		}
+		key.Private = private
+		key.Public = private.(crypto.Signer).Public()
+
+		keys[key.ID] = &key
+		if key.RetiredAt == nil {
+			signers = append(signers, &key)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.signers = signers
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// rotate creates a new key, which signs once it has been published for
+// keyPublishDelay, and retires the keys it has replaced. With onlyIfDue it
+// leaves a key alone that is younger than the rotation period. Instances take
+// an advisory lock so only one of them rotates.
+func (s *KeyStore) rotate(onlyIfDue bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", keyRotationLockID); err != nil {
+		return err
+	}
+
+	// Keys written by instances of an earlier version are still plain PEM
+	if err := s.encryptKeys(tx); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("DELETE FROM signing_keys WHERE retired_at <= $1", now.Add(-s.grace)); err != nil {
+		return err
+	}
+
+	var (
+		algorithm string
+		createdAt time.Time
+	)
+	err = tx.QueryRow(`
+		SELECT algorithm, created_at FROM signing_keys
+		WHERE retired_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+	`).Scan(&algorithm, &createdAt)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	// Without a key of the configured algorithm there is nothing to sign with
+	// while a new one is published, so it signs right away
+	immediate := err == sql.ErrNoRows || algorithm != s.algorithm
+	due := immediate || (s.rotation > 0 && now.Sub(createdAt) >= s.rotation)
+	if due || !onlyIfDue {
+		kid, privatePEM, err := generateSigningKey(s.algorithm)
+		if err != nil {
+			return err
+		}
+		encrypted, err := s.encryptPrivateKey(kid, privatePEM)
+		if err != nil {
+			return err
+		}
+
+		if immediate {
+			if _, err := tx.Exec("UPDATE signing_keys SET retired_at = $1 WHERE retired_at IS NULL", now); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`
+			INSERT INTO signing_keys (kid, algorithm, private_key, created_at)
+			VALUES ($1, $2, $3, $4)
+		`, kid, s.algorithm, encrypted, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Keys older than the one signing now are replaced and start their grace
+	// period
+	_, err = tx.Exec(`
+		UPDATE signing_keys SET retired_at = $1
+		WHERE retired_at IS NULL AND created_at < (
+			SELECT MAX(created_at) FROM signing_keys
+			WHERE retired_at IS NULL AND created_at <= $2
+		)
+	`, now, now.Add(-keyPublishDelay))
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+// encryptStoredKeys encrypts the private keys still stored as plain PEM
+func (s *KeyStore) encryptStoredKeys() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", keyRotationLockID); err != nil {
+		return err
+	}
+	if err := s.encryptKeys(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *KeyStore) encryptKeys(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT kid, private_key FROM signing_keys WHERE private_key NOT LIKE $1", encryptedKeyPrefix+"%")
+	if err != nil {
+		return err
+	}
+
+	plain := map[string]string{}
+	for rows.Next() {
+		var kid, privatePEM string
+		if err := rows.Scan(&kid, &privatePEM); err != nil {
+			rows.Close()
+			return err
+		}
+		plain[kid] = privatePEM
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for kid, privatePEM := range plain {
+		encrypted, err := s.encryptPrivateKey(kid, privatePEM)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE signing_keys SET private_key = $1 WHERE kid = $2", encrypted, kid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptPrivateKey seals privatePEM under the key-encryption key. The kid is
+// authenticated as well, so a key cannot be moved to another row.
+func (s *KeyStore) encryptPrivateKey(kid, privatePEM string) (string, error) {
+	nonce := make([]byte, s.kek.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.kek.Seal(nonce, nonce, []byte(privatePEM), []byte(kid))
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptPrivateKey returns the PEM of a stored private key. Plain PEM from
+// earlier versions is returned as it is until encryptKeys has run.
+func (s *KeyStore) decryptPrivateKey(kid, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedKeyPrefix) {
+		return stored, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyPrefix))
+	if err != nil || len(sealed) < s.kek.NonceSize() {
+		return "", fmt.Errorf("signing key %s is not validly encrypted", kid)
+	}
+	nonce, ciphertext := sealed[:s.kek.NonceSize()], sealed[s.kek.NonceSize():]
+	plain, err := s.kek.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return "", fmt.Errorf("signing key %s cannot be decrypted, check JWT_KEY_ENCRYPTION_KEY", kid)
+	}
+	return string(plain), nil
+}
+
+// newKeyEncryptionCipher returns AES-256-GCM with the base64 encoded key
+func newKeyEncryptionCipher(encoded string) (cipher.AEAD, error) {
+	if encoded == "" {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY is required to store signing keys")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be 32 bytes, base64 encoded")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// generateSigningKey returns a new kid and PKCS #8 PEM private key
+func generateSigningKey(algorithm string) (string, string, error) {
+	var (
+		private crypto.PrivateKey
+		err     error
+	)
+	switch algorithm {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The kid is derived from the public key, like an RFC 7638 thumbprint
+	publicDER, err := x509.MarshalPKIXPublicKey(private.(crypto.Signer).Public())
+	if err != nil {
+		return "", "", err
+	}
+	kid := HashToken(string(publicDER))[:16]
+
+	return kid, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
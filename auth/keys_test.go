@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCurrentSignerWaitsForPublication(t *testing.T) {
+	now := time.Now()
+	previous := &signingKey{ID: "previous", CreatedAt: now.Add(-24 * time.Hour)}
+	next := &signingKey{ID: "next", CreatedAt: now.Add(-time.Minute)}
+	s := &KeyStore{signers: []*signingKey{next, previous}}
+
+	if key := s.currentSigner(now); key != previous {
+		t.Errorf("signs with %s before the new key is published, want previous", key.ID)
+	}
+	if key := s.currentSigner(now.Add(keyPublishDelay)); key != next {
+		t.Errorf("signs with %s once the new key is published, want next", key.ID)
+	}
+}
+
+func TestCurrentSignerUsesOnlyKeyRightAway(t *testing.T) {
+	now := time.Now()
+	first := &signingKey{ID: "first", CreatedAt: now}
+	s := &KeyStore{signers: []*signingKey{first}}
+
+	if key := s.currentSigner(now); key != first {
+		t.Errorf("first key does not sign right away")
+	}
+	if key := (&KeyStore{}).currentSigner(now); key != nil {
+		t.Errorf("signs with %s without keys", key.ID)
+	}
+}
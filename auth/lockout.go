@@ -0,0 +1,25 @@
+package auth
+
+import "time"
+
+// LoginBackoff returns how long further login attempts are refused after
+// failures consecutive failed attempts. From backoffAfter failures on the
+// delay starts at base and doubles with every failure up to max; from
+// lockoutAfter failures on it is the full lockout duration.
+func LoginBackoff(failures, backoffAfter, lockoutAfter int, base, max, lockout time.Duration) time.Duration {
+	if lockoutAfter > 0 && failures >= lockoutAfter {
+		return lockout
+	}
+	if backoffAfter <= 0 || failures < backoffAfter {
+		return 0
+	}
+
+	delay := base
+	for i := backoffAfter; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// CompareDummyPassword spends as long as checking a real password, so unknown
+// usernames cannot be told apart by response time
+func CompareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+// PasswordPolicy describes the rules a new password has to satisfy
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	breached      map[string]bool
+}
+
+// NewPasswordPolicy returns a policy that also rejects passwords found in the
+// built-in list of common passwords and, if breachedListPath is set, in that
+// file (one password per line)
+func NewPasswordPolicy(minLength int, upper, lower, digit, symbol bool, breachedListPath string) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength:     minLength,
+		RequireUpper:  upper,
+		RequireLower:  lower,
+		RequireDigit:  digit,
+		RequireSymbol: symbol,
+		breached:      map[string]bool{},
+	}
+
+	if err := policy.addBreached(strings.NewReader(commonPasswords)); err != nil {
+		return nil, err
+	}
+
+	if breachedListPath != "" {
+		f, err := os.Open(breachedListPath)
+		if err != nil {
+			return nil, fmt.Errorf("open breached password list: %w", err)
+		}
+		defer f.Close()
+
+		if err := policy.addBreached(f); err != nil {
+			return nil, fmt.Errorf("read breached password list: %w", err)
+		}
+	}
+
+	return policy, nil
+}
+
+func (p *PasswordPolicy) addBreached(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			p.breached[strings.ToLower(line)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// Validate returns a list of the rules password violates, or nil when it is
+// acceptable
+func (p *PasswordPolicy) Validate(password, username string) []string {
+	var problems []string
+
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	// bcrypt only looks at the first 72 bytes
+	if len(password) > 72 {
+		problems = append(problems, "must be at most 72 bytes long")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r), unicode.IsSymbol(r), unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		problems = append(problems, "must not contain the username")
+	}
+
+	if p.breached[strings.ToLower(password)] {
+		problems = append(problems, "is too common and appears in lists of breached passwords")
+	}
+
+	return problems
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Names that could be mistaken for system accounts
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"root":          true,
+	"system":        true,
+	"support":       true,
+	"me":            true,
+}
+
+// ValidateUsername checks the rules for self-chosen usernames
+func ValidateUsername(username string, minLength, maxLength int) []string {
+	problems := ValidateUsernameFormat(username, minLength, maxLength)
+	if reservedUsernames[strings.ToLower(username)] {
+		problems = append(problems, "is reserved")
+	}
+
+	return problems
+}
+
+// ValidateUsernameFormat checks length and characters of a username but,
+// unlike ValidateUsername, allows reserved names
+func ValidateUsernameFormat(username string, minLength, maxLength int) []string {
+	var problems []string
+
+	if length := len(username); length < minLength || length > maxLength {
+		problems = append(problems, fmt.Sprintf("must be between %d and %d characters long", minLength, maxLength))
+	}
+	if !usernamePattern.MatchString(username) {
+		problems = append(problems, "may only contain letters, digits, '.', '_' and '-', and must start with a letter or digit")
+	}
+
+	return problems
+}
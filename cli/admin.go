@@ -0,0 +1,263 @@
+// Package cli implements the command line subcommands of the server binary
+package cli
+
+import (
+	"book-management-api/auth"
+	"book-management-api/config"
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// Recorded in created_by/modified_by for changes made from the command line
+const cliUser = "cli"
+
+// Hash of the admin123 password older installations seeded their admin
+// account with; migration 023 disables accounts still using it
+const seededAdminHash = "$2a$10$6v4IMCcL8NZT/JSF9fSwr.fQx/zWzsBGJF8N9m3bj5RRS4HSPpjUy"
+
+const adminUsage = `Usage:
+  book-management-api admin create --username NAME [--role ROLE] [--organization SLUG] [--password-file PATH]
+  book-management-api admin reset-password --username NAME [--password-file PATH]
+  book-management-api admin list
+
+Passwords are read from --password-file, or from standard input. When
+standard input is a terminal you are prompted for the password. New accounts
+join the organization DEFAULT_ORGANIZATION unless --organization names another.`
+
+// Admin runs the "admin" subcommand with args, the arguments following it
+func Admin(db *sql.DB, cfg *config.Config, passwordPolicy *auth.PasswordPolicy, args []string) error {
+	if len(args) == 0 {
+		return errors.New(adminUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return adminCreate(db, cfg, passwordPolicy, args[1:])
+	case "reset-password":
+		return adminResetPassword(db, passwordPolicy, args[1:])
+	case "list":
+		return adminList(db, os.Stdout)
+	default:
+		return fmt.Errorf("unknown admin command %q\n\n%s", args[0], adminUsage)
+	}
+}
+
+func adminCreate(db *sql.DB, cfg *config.Config, passwordPolicy *auth.PasswordPolicy, args []string) error {
+	flags := flag.NewFlagSet("admin create", flag.ContinueOnError)
+	username := flags.String("username", "", "username of the new account")
+	role := flags.String("role", "admin", "role of the new account")
+	organization := flags.String("organization", cfg.Tenancy.DefaultOrganization, "slug of the organization the account joins")
+	passwordFile := flags.String("password-file", "", "read the password from this file instead of standard input")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	*username = strings.TrimSpace(*username)
+	if *username == "" {
+		return errors.New("--username is required")
+	}
+
+	// The operator may pick reserved names such as "admin"
+	if problems := auth.ValidateUsernameFormat(*username, cfg.Registration.UsernameMinLength, cfg.Registration.UsernameMaxLength); len(problems) > 0 {
+		return fmt.Errorf("username %s", strings.Join(problems, "; username "))
+	}
+
+	var roleExists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", *role).Scan(&roleExists); err != nil {
+		return err
+	}
+	if !roleExists {
+		return fmt.Errorf("role %q does not exist", *role)
+	}
+
+	var organizationID int
+	err := db.QueryRow("SELECT id FROM organizations WHERE slug = $1", *organization).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("organization %q does not exist", *organization)
+	}
+	if err != nil {
+		return err
+	}
+
+	var taken bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))", *username).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("user %q already exists, use reset-password to change its password", *username)
+	}
+
+	hashedPassword, err := readPassword(*passwordFile, *username, passwordPolicy)
+	if err != nil {
+		return err
+	}
+
+	var id int
+	err = db.QueryRow(`
+		INSERT INTO users (username, password, role, status, organization_id, created_by, modified_by)
+		VALUES ($1, $2, $3, 'active', $4, $5, $5)
+		RETURNING id
+	`, *username, hashedPassword, *role, organizationID, cliUser).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created user %q (id %d) with role %q in organization %q\n", *username, id, *role, *organization)
+	return nil
+}
+
+func adminResetPassword(db *sql.DB, passwordPolicy *auth.PasswordPolicy, args []string) error {
+	flags := flag.NewFlagSet("admin reset-password", flag.ContinueOnError)
+	username := flags.String("username", "", "username of the account")
+	passwordFile := flags.String("password-file", "", "read the password from this file instead of standard input")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	*username = strings.TrimSpace(*username)
+	if *username == "" {
+		return errors.New("--username is required")
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))", *username).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("user %q not found", *username)
+	}
+
+	hashedPassword, err := readPassword(*passwordFile, *username, passwordPolicy)
+	if err != nil {
+		return err
+	}
+
+	// Ends all sessions of the user, as after a logout-all. Accounts disabled
+	// for still using the seeded password are enabled again, and keep the flag
+	// to change the password at the next login.
+	_, err = db.Exec(`
+		UPDATE users
+		SET password = $1, must_change_password = (password = $4), token_version = token_version + 1,
+			status = CASE WHEN password = $4 THEN 'active' ELSE status END,
+			modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE LOWER(username) = LOWER($3)
+	`, hashedPassword, cliUser, *username, seededAdminHash)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Password of user %q updated\n", *username)
+	return nil
+}
+
+func adminList(db *sql.DB, out io.Writer) error {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.role, o.slug, u.status, u.created_at
+		FROM users u
+		JOIN organizations o ON u.organization_id = o.id
+		WHERE u.role IN ('admin', 'super_admin')
+		ORDER BY u.id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tORGANIZATION\tSTATUS\tCREATED")
+	for rows.Next() {
+		var (
+			id                                   int
+			username, role, organization, status string
+			createdAt                            sql.NullTime
+		)
+		if err := rows.Scan(&id, &username, &role, &organization, &status, &createdAt); err != nil {
+			return err
+		}
+
+		created := "-"
+		if createdAt.Valid {
+			created = createdAt.Time.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", id, username, role, organization, status, created)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// readPassword reads a password from path, or from standard input when path
+// is empty, checks it against the policy and returns its bcrypt hash
+func readPassword(path, username string, passwordPolicy *auth.PasswordPolicy) (string, error) {
+	var password string
+
+	switch {
+	case path != "":
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		password = firstLine(string(content))
+
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		fmt.Fprint(os.Stderr, "Password: ")
+		first, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprint(os.Stderr, "Repeat password: ")
+		second, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+
+		if string(first) != string(second) {
+			return "", errors.New("passwords do not match")
+		}
+		password = string(first)
+
+	default:
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		password = firstLine(line)
+	}
+
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+
+	if problems := passwordPolicy.Validate(password, username); len(problems) > 0 {
+		return "", fmt.Errorf("password %s", strings.Join(problems, "; password "))
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// firstLine returns s up to the first line break
+func firstLine(s string) string {
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
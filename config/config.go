@@ -3,17 +3,106 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	DatabaseURL string
-	Environment string
-	JWTSecret   string
-	BasicAuth   struct {
-		Username string
-		Password string
+	// Connection for migrations, the admin commands and lookups across
+	// organizations, as a role that bypasses row-level security
+	AdminDatabaseURL string
+	Environment      string
+	JWTSecret        string
+	Tokens           struct {
+		AccessTTL      time.Duration
+		RefreshTTL     time.Duration
+		Algorithm      string
+		Issuer         string
+		Audience       string
+		KeyRotation    time.Duration
+		KeyGracePeriod time.Duration
+		// Base64 encoded AES-256 key that encrypts the stored signing keys
+		KeyEncryptionKey string
+	}
+	// Authenticators tried, in order, on each group of routes: "jwt",
+	// "api_key" and/or "basic"
+	Auth struct {
+		Me         []string
+		Admin      []string
+		Categories []string
+		Books      []string
+		Lists      []string
+	}
+	Storage struct {
+		Path          string
+		MaxUploadSize int64
+	}
+	Tenancy struct {
+		// Slug of the organization used when a request does not name one,
+		// e.g. for registrations and the public storefront
+		DefaultOrganization string
+	}
+	Registration struct {
+		Enabled           bool
+		RequireApproval   bool
+		UsernameMinLength int
+		UsernameMaxLength int
+	}
+	LoginProtection struct {
+		FailureWindow        time.Duration
+		BackoffBase          time.Duration
+		BackoffMax           time.Duration
+		UsernameBackoffAfter int
+		UsernameLockoutAfter int
+		IPBackoffAfter       int
+		IPLockoutAfter       int
+		LockoutDuration      time.Duration
+	}
+	OIDC struct {
+		Enabled       bool
+		IssuerURL     string
+		ClientID      string
+		ClientSecret  string
+		RedirectURL   string
+		Scopes        []string
+		UsernameClaim string
+		EmailClaim    string
+		RoleClaim     string
+		RoleMapping   map[string]string
+		DefaultRole   string
+		AutoProvision bool
+	}
+	Mail struct {
+		Driver       string
+		From         string
+		SMTPHost     string
+		SMTPPort     int
+		SMTPUsername string
+		SMTPPassword string
+		FilePath     string
+	}
+	PasswordReset struct {
+		TokenTTL time.Duration
+		URL      string
+		// Minimum time between two reset mails to the same account
+		ResendInterval time.Duration
+	}
+	MFA struct {
+		Issuer       string
+		ChallengeTTL time.Duration
+		MaxAttempts  int
+	}
+	PasswordPolicy struct {
+		MinLength        int
+		RequireUpper     bool
+		RequireLower     bool
+		RequireDigit     bool
+		RequireSymbol    bool
+		BreachedListPath string
 	}
 }
 
@@ -29,8 +118,77 @@ func Load() *Config {
 		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-this-in-production"),
 	}
 
-	cfg.BasicAuth.Username = getEnv("BASIC_AUTH_USERNAME", "admin")
-	cfg.BasicAuth.Password = getEnv("BASIC_AUTH_PASSWORD", "password")
+	cfg.AdminDatabaseURL = getEnv("ADMIN_DATABASE_URL", cfg.DatabaseURL)
+
+	cfg.Tokens.AccessTTL = time.Duration(getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute
+	cfg.Tokens.RefreshTTL = time.Duration(getEnvInt("REFRESH_TOKEN_TTL_HOURS", 720)) * time.Hour
+	cfg.Tokens.Algorithm = getEnv("JWT_ALGORITHM", "RS256")
+	cfg.Tokens.Issuer = getEnv("JWT_ISSUER", "book-management-api")
+	cfg.Tokens.Audience = getEnv("JWT_AUDIENCE", "book-management-api")
+	cfg.Tokens.KeyRotation = time.Duration(getEnvInt("JWT_KEY_ROTATION_HOURS", 720)) * time.Hour
+	cfg.Tokens.KeyGracePeriod = time.Duration(getEnvInt("JWT_KEY_GRACE_HOURS", 24)) * time.Hour
+	cfg.Tokens.KeyEncryptionKey = getEnv("JWT_KEY_ENCRYPTION_KEY", "")
+
+	cfg.Auth.Me = getEnvAuthenticators("AUTH_ME", "jwt")
+	cfg.Auth.Admin = getEnvAuthenticators("AUTH_ADMIN", "jwt,api_key")
+	cfg.Auth.Categories = getEnvAuthenticators("AUTH_CATEGORIES", "jwt,api_key")
+	cfg.Auth.Books = getEnvAuthenticators("AUTH_BOOKS", "jwt,api_key")
+	cfg.Auth.Lists = getEnvAuthenticators("AUTH_LISTS", "jwt,api_key")
+
+	cfg.Storage.Path = getEnv("STORAGE_PATH", "./storage-data")
+	cfg.Storage.MaxUploadSize = int64(getEnvInt("MAX_UPLOAD_SIZE_MB", 200)) << 20
+
+	cfg.Tenancy.DefaultOrganization = getEnv("DEFAULT_ORGANIZATION", "default")
+
+	cfg.Registration.Enabled = getEnvBool("REGISTRATION_ENABLED", true)
+	cfg.Registration.RequireApproval = getEnvBool("REGISTRATION_REQUIRE_APPROVAL", false)
+	cfg.Registration.UsernameMinLength = getEnvInt("USERNAME_MIN_LENGTH", 3)
+	cfg.Registration.UsernameMaxLength = getEnvInt("USERNAME_MAX_LENGTH", 32)
+
+	cfg.PasswordPolicy.MinLength = getEnvInt("PASSWORD_MIN_LENGTH", 10)
+	cfg.PasswordPolicy.RequireUpper = getEnvBool("PASSWORD_REQUIRE_UPPER", true)
+	cfg.PasswordPolicy.RequireLower = getEnvBool("PASSWORD_REQUIRE_LOWER", true)
+	cfg.PasswordPolicy.RequireDigit = getEnvBool("PASSWORD_REQUIRE_DIGIT", true)
+	cfg.PasswordPolicy.RequireSymbol = getEnvBool("PASSWORD_REQUIRE_SYMBOL", false)
+	cfg.PasswordPolicy.BreachedListPath = getEnv("PASSWORD_BREACHED_LIST", "")
+
+	cfg.LoginProtection.FailureWindow = time.Duration(getEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute
+	cfg.LoginProtection.BackoffBase = time.Duration(getEnvInt("LOGIN_BACKOFF_BASE_SECONDS", 1)) * time.Second
+	cfg.LoginProtection.BackoffMax = time.Duration(getEnvInt("LOGIN_BACKOFF_MAX_SECONDS", 60)) * time.Second
+	cfg.LoginProtection.UsernameBackoffAfter = getEnvInt("LOGIN_USERNAME_BACKOFF_AFTER", 3)
+	cfg.LoginProtection.UsernameLockoutAfter = getEnvInt("LOGIN_USERNAME_LOCKOUT_AFTER", 10)
+	cfg.LoginProtection.IPBackoffAfter = getEnvInt("LOGIN_IP_BACKOFF_AFTER", 10)
+	cfg.LoginProtection.IPLockoutAfter = getEnvInt("LOGIN_IP_LOCKOUT_AFTER", 100)
+	cfg.LoginProtection.LockoutDuration = time.Duration(getEnvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+
+	cfg.OIDC.Enabled = getEnvBool("OIDC_ENABLED", false)
+	cfg.OIDC.IssuerURL = getEnv("OIDC_ISSUER_URL", "")
+	cfg.OIDC.ClientID = getEnv("OIDC_CLIENT_ID", "")
+	cfg.OIDC.ClientSecret = getEnv("OIDC_CLIENT_SECRET", "")
+	cfg.OIDC.RedirectURL = getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/users/oidc/callback")
+	cfg.OIDC.Scopes = strings.Fields(getEnv("OIDC_SCOPES", "openid profile email"))
+	cfg.OIDC.UsernameClaim = getEnv("OIDC_USERNAME_CLAIM", "preferred_username")
+	cfg.OIDC.EmailClaim = getEnv("OIDC_EMAIL_CLAIM", "email")
+	cfg.OIDC.RoleClaim = getEnv("OIDC_ROLE_CLAIM", "")
+	cfg.OIDC.RoleMapping = getEnvMapping("OIDC_ROLE_MAPPING")
+	cfg.OIDC.DefaultRole = getEnv("OIDC_DEFAULT_ROLE", "reader")
+	cfg.OIDC.AutoProvision = getEnvBool("OIDC_AUTO_PROVISION", true)
+
+	cfg.Mail.Driver = getEnv("MAIL_DRIVER", "log")
+	cfg.Mail.From = getEnv("MAIL_FROM", "Book Management <no-reply@localhost>")
+	cfg.Mail.SMTPHost = getEnv("SMTP_HOST", "")
+	cfg.Mail.SMTPPort = getEnvInt("SMTP_PORT", 587)
+	cfg.Mail.SMTPUsername = getEnv("SMTP_USERNAME", "")
+	cfg.Mail.SMTPPassword = getEnv("SMTP_PASSWORD", "")
+	cfg.Mail.FilePath = getEnv("MAIL_FILE_PATH", "./mail-outbox.eml")
+
+	cfg.PasswordReset.TokenTTL = time.Duration(getEnvInt("PASSWORD_RESET_TTL_MINUTES", 60)) * time.Minute
+	cfg.PasswordReset.URL = getEnv("PASSWORD_RESET_URL", "http://localhost:8080/reset-password?token=")
+	cfg.PasswordReset.ResendInterval = time.Duration(getEnvInt("PASSWORD_RESET_RESEND_MINUTES", 5)) * time.Minute
+
+	cfg.MFA.Issuer = getEnv("MFA_ISSUER", "Book Management API")
+	cfg.MFA.ChallengeTTL = time.Duration(getEnvInt("MFA_CHALLENGE_TTL_MINUTES", 5)) * time.Minute
+	cfg.MFA.MaxAttempts = getEnvInt("MFA_MAX_ATTEMPTS", 5)
 
 	return cfg
 }
@@ -40,4 +198,74 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %t", key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvAuthenticators reads a comma-separated list of authenticator names
+func getEnvAuthenticators(key, defaultValue string) []string {
+	var names []string
+	for _, name := range strings.Split(getEnv(key, defaultValue), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+			continue
+		case "jwt", "api_key", "basic":
+			names = append(names, name)
+		default:
+			log.Printf("Invalid value for %s, using default %s", key, defaultValue)
+			return strings.Split(defaultValue, ",")
+		}
+	}
+
+	if len(names) == 0 {
+		log.Printf("Invalid value for %s, using default %s", key, defaultValue)
+		return strings.Split(defaultValue, ",")
+	}
+	return names
+}
+
+// getEnvMapping reads a comma-separated list of from=to pairs. Malformed
+// pairs are skipped.
+func getEnvMapping(key string) map[string]string {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			log.Printf("Invalid pair %q in %s, skipping it", pair, key)
+			continue
+		}
+		mapping[from] = to
+	}
+	return mapping
+}
@@ -24,6 +24,14 @@ func Connect(databaseURL string) (*sql.DB, error) {
 	return db, nil
 }
 
+// BypassesRowLevelSecurity reports whether the role db connects as is exempt
+// from row-level security, as superusers and roles with BYPASSRLS are
+func BypassesRowLevelSecurity(db *sql.DB) (bool, error) {
+	var bypass bool
+	err := db.QueryRow("SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user").Scan(&bypass)
+	return bypass, err
+}
+
 func RunMigrations(databaseURL string) error {
 	migrations := &migrate.EmbedFileSystemMigrationSource{
 		FileSystem: migrationFiles,
@@ -36,6 +44,9 @@ func RunMigrations(databaseURL string) error {
 	}
 	defer db.Close()
 
-	_, err = migrate.Exec(db, "postgres", migrations, migrate.Up)
-	return err
+	if _, err := migrate.Exec(db, "postgres", migrations, migrate.Up); err != nil {
+		return err
+	}
+
+	return backfillCategorySlugs(db)
 }
\ No newline at end of file
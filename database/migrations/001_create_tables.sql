@@ -43,10 +43,6 @@ CREATE INDEX IF NOT EXISTS idx_books_category_id ON books(category_id);
 CREATE INDEX IF NOT EXISTS idx_books_release_year ON books(release_year);
 CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
 
--- Insert default admin user (password: admin123)
-INSERT INTO users (username, password, created_by) VALUES 
-('admin', '$2a$10$6v4IMCcL8NZT/JSF9fSwr.fQx/zWzsBGJF8N9m3bj5RRS4HSPpjUy', 'system');
-
 -- Insert sample categories
 INSERT INTO categories (name, created_by) VALUES 
 ('Fiction', 'system'),
@@ -0,0 +1,23 @@
+-- +migrate Up
+
+-- Create book_files table for ebook attachments
+CREATE TABLE IF NOT EXISTS book_files (
+    id SERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('epub', 'pdf')),
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    storage_key VARCHAR(512) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255),
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_by VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_files_book_id ON book_files(book_id);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS book_files;
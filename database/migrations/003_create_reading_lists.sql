@@ -0,0 +1,39 @@
+-- +migrate Up
+
+-- Create reading_lists table for personal reading lists and wishlists
+CREATE TABLE IF NOT EXISTS reading_lists (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    kind VARCHAR(20) NOT NULL DEFAULT 'reading' CHECK (kind IN ('reading', 'wishlist')),
+    visibility VARCHAR(20) NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'unlisted', 'public')),
+    share_token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255),
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_by VARCHAR(255)
+);
+
+-- Create reading_list_items table, one row per book in a list
+CREATE TABLE IF NOT EXISTS reading_list_items (
+    id SERIAL PRIMARY KEY,
+    list_id INTEGER NOT NULL REFERENCES reading_lists(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255),
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_by VARCHAR(255),
+    CONSTRAINT uq_reading_list_items_book UNIQUE (list_id, book_id),
+    CONSTRAINT uq_reading_list_items_position UNIQUE (list_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE INDEX IF NOT EXISTS idx_reading_lists_user_id ON reading_lists(user_id);
+CREATE INDEX IF NOT EXISTS idx_reading_lists_visibility ON reading_lists(visibility);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS reading_list_items;
+DROP TABLE IF EXISTS reading_lists;
@@ -0,0 +1,25 @@
+-- +migrate Up
+
+-- Create reading_progress table, one row per user and book
+CREATE TABLE IF NOT EXISTS reading_progress (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    current_page INTEGER NOT NULL DEFAULT 0 CHECK (current_page >= 0),
+    percentage NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (percentage BETWEEN 0 AND 100),
+    status VARCHAR(20) NOT NULL DEFAULT 'reading' CHECK (status IN ('reading', 'finished')),
+    started_at DATE NOT NULL DEFAULT CURRENT_DATE,
+    finished_at DATE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255),
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_by VARCHAR(255),
+    CONSTRAINT uq_reading_progress_user_book UNIQUE (user_id, book_id),
+    CONSTRAINT chk_reading_progress_dates CHECK (finished_at IS NULL OR finished_at >= started_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reading_progress_user_status ON reading_progress(user_id, status);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS reading_progress;
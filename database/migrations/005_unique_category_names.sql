@@ -0,0 +1,36 @@
+-- +migrate Up
+
+-- Normalize surrounding whitespace in existing names
+UPDATE categories SET name = TRIM(name) WHERE name <> TRIM(name);
+
+-- Refuse to continue while case-insensitive duplicates exist, listing them so
+-- they can be renamed or merged by hand
+-- +migrate StatementBegin
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(format('%s => %s', grp.name_key, grp.rows), '; ')
+    INTO conflicts
+    FROM (
+        SELECT LOWER(TRIM(name)) AS name_key,
+               string_agg(format('id %s (%s)', id, quote_literal(name)), ', ' ORDER BY id) AS rows
+        FROM categories
+        GROUP BY LOWER(TRIM(name))
+        HAVING COUNT(*) > 1
+    ) grp;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'Cannot enforce unique category names, conflicting categories: %', conflicts
+            USING HINT = 'Rename or merge the listed categories, then run the migrations again.';
+    END IF;
+END
+$$;
+-- +migrate StatementEnd
+
+-- Enforce case-insensitive unique names
+CREATE UNIQUE INDEX IF NOT EXISTS uq_categories_name_normalized ON categories (LOWER(TRIM(name)));
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS uq_categories_name_normalized;
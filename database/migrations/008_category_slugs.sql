@@ -0,0 +1,23 @@
+-- +migrate Up
+
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS slug VARCHAR(255);
+
+-- Existing categories get their slugs after the migrations have run, from
+-- backfillCategorySlugs in database/slugs.go, which uses the same slug rules
+-- as the API and then makes the column NOT NULL
+ALTER TABLE categories ADD CONSTRAINT uq_categories_slug UNIQUE (slug);
+
+-- Previous slugs of renamed categories, kept so old URLs can redirect
+CREATE TABLE IF NOT EXISTS category_slug_history (
+    slug VARCHAR(255) PRIMARY KEY,
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_category_slug_history_category_id ON category_slug_history(category_id);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS category_slug_history;
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS uq_categories_slug;
+ALTER TABLE categories DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- Manual ordering and storefront visibility for categories
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS is_visible BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Keep the current ID order as the initial manual order
+UPDATE categories SET position = ordered.position
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS position FROM categories) ordered
+WHERE categories.id = ordered.id;
+
+CREATE INDEX IF NOT EXISTS idx_categories_position ON categories(position);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_categories_position;
+ALTER TABLE categories DROP COLUMN IF EXISTS is_visible;
+ALTER TABLE categories DROP COLUMN IF EXISTS position;
@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- Account role and lifecycle status for self-service registration
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(50) NOT NULL DEFAULT 'reader';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'pending', 'disabled'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS approved_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS approved_by VARCHAR(255);
+
+-- Accounts created before registration existed were all staff accounts with
+-- full access, keep it that way
+UPDATE users SET role = 'admin';
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_users_username_lower ON users (LOWER(username));
+CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_users_status;
+DROP INDEX IF EXISTS uq_users_username_lower;
+ALTER TABLE users DROP COLUMN IF EXISTS approved_by;
+ALTER TABLE users DROP COLUMN IF EXISTS approved_at;
+ALTER TABLE users DROP COLUMN IF EXISTS status;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
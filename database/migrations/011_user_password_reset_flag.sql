@@ -0,0 +1,8 @@
+-- +migrate Up
+
+-- Set when an administrator forces a password reset
+ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +migrate Down
+
+ALTER TABLE users DROP COLUMN IF EXISTS must_change_password;
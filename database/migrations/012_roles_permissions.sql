@@ -0,0 +1,69 @@
+-- +migrate Up
+
+-- Roles and the permissions they grant. Route guards check permissions, so a
+-- role's access can change without touching the code.
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255),
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_by VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_name VARCHAR(50) NOT NULL REFERENCES roles(name) ON UPDATE CASCADE ON DELETE CASCADE,
+    permission_name VARCHAR(100) NOT NULL REFERENCES permissions(name) ON UPDATE CASCADE ON DELETE CASCADE,
+    PRIMARY KEY (role_name, permission_name)
+);
+
+INSERT INTO roles (name, description, created_by, modified_by) VALUES
+    ('admin', 'Full access including user management', 'system', 'system'),
+    ('librarian', 'Maintains the catalog but cannot delete from it', 'system', 'system'),
+    ('reader', 'Browses the catalog and keeps personal reading lists and progress', 'system', 'system')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('books:read', 'View books and their files'),
+    ('books:create', 'Add books and upload book files'),
+    ('books:delete', 'Delete books and book files'),
+    ('categories:read', 'View categories'),
+    ('categories:create', 'Add categories'),
+    ('categories:update', 'Rename, move, reorder and hide categories'),
+    ('categories:delete', 'Delete and merge categories'),
+    ('reading:write', 'Track own reading progress and manage own reading lists'),
+    ('users:manage', 'Manage user accounts and approve registrations')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_name, permission_name)
+SELECT 'admin', name FROM permissions
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('librarian', 'books:read'),
+    ('librarian', 'books:create'),
+    ('librarian', 'categories:read'),
+    ('librarian', 'categories:create'),
+    ('librarian', 'categories:update'),
+    ('librarian', 'reading:write'),
+    ('reader', 'books:read'),
+    ('reader', 'categories:read'),
+    ('reader', 'reading:write')
+ON CONFLICT DO NOTHING;
+
+-- Every user needs a known role
+UPDATE users SET role = 'reader' WHERE role NOT IN (SELECT name FROM roles);
+ALTER TABLE users ADD CONSTRAINT fk_users_role
+    FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
+
+-- +migrate Down
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS fk_users_role;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,19 @@
+-- +migrate Up
+
+-- Failed login counters per client IP and per username. Usernames that do not
+-- exist are tracked the same way, so lockouts do not reveal which accounts
+-- exist.
+CREATE TABLE IF NOT EXISTS login_throttles (
+    scope VARCHAR(20) NOT NULL CHECK (scope IN ('ip', 'username')),
+    key VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    blocked_until TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_throttles_last_failure_at ON login_throttles(last_failure_at);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS login_throttles;
@@ -0,0 +1,15 @@
+-- +migrate Up
+
+-- Private keys for signing access tokens. The newest key without retired_at
+-- signs; retired keys keep verifying tokens until the grace period is over.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(10) NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    retired_at TIMESTAMP
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS signing_keys;
@@ -0,0 +1,23 @@
+-- +migrate Up
+
+-- Every login attempt, successful or not. The username is kept as typed, so
+-- attempts for unknown or later deleted accounts stay readable.
+CREATE TABLE IF NOT EXISTS login_events (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    username VARCHAR(255) NOT NULL,
+    method VARCHAR(20) NOT NULL,
+    success BOOLEAN NOT NULL,
+    failure_reason VARCHAR(50),
+    session_id VARCHAR(64),
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user_id_created_at ON login_events(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_events_created_at ON login_events(created_at);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS login_events;
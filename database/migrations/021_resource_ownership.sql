@@ -0,0 +1,63 @@
+-- +migrate Up
+
+-- The user who owns a book or category. created_by keeps the name as it was
+-- written, while the owner can change and is cleared when the user is deleted.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS created_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS created_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_categories_created_by_user_id ON categories(created_by_user_id);
+CREATE INDEX IF NOT EXISTS idx_books_created_by_user_id ON books(created_by_user_id);
+
+UPDATE categories SET created_by_user_id = users.id
+FROM users
+WHERE categories.created_by_user_id IS NULL AND users.username = categories.created_by;
+
+UPDATE books SET created_by_user_id = users.id
+FROM users
+WHERE books.created_by_user_id IS NULL AND users.username = books.created_by;
+
+-- The update and delete permissions now cover every record; owners may
+-- update and delete their own records with just the create permission
+INSERT INTO permissions (name, description) VALUES
+    ('books:update', 'Edit any book and upload its files')
+ON CONFLICT (name) DO NOTHING;
+
+UPDATE permissions SET description = 'Add books and edit, upload files to and delete own books' WHERE name = 'books:create';
+UPDATE permissions SET description = 'Delete any book and its files' WHERE name = 'books:delete';
+UPDATE permissions SET description = 'Add categories and edit and delete own categories' WHERE name = 'categories:create';
+UPDATE permissions SET description = 'Rename, move, reorder and hide any category' WHERE name = 'categories:update';
+UPDATE permissions SET description = 'Delete and merge any category' WHERE name = 'categories:delete';
+
+INSERT INTO roles (name, description, created_by, modified_by) VALUES
+    ('editor', 'Edits the whole catalog but cannot add or delete', 'system', 'system')
+ON CONFLICT (name) DO NOTHING;
+
+UPDATE roles SET description = 'Maintains the catalog but only deletes what they own' WHERE name = 'librarian';
+
+INSERT INTO role_permissions (role_name, permission_name) VALUES
+    ('admin', 'books:update'),
+    ('librarian', 'books:update'),
+    ('editor', 'books:read'),
+    ('editor', 'books:update'),
+    ('editor', 'categories:read'),
+    ('editor', 'categories:update'),
+    ('editor', 'reading:write')
+ON CONFLICT DO NOTHING;
+
+-- +migrate Down
+
+UPDATE users SET role = 'reader' WHERE role = 'editor';
+DELETE FROM roles WHERE name = 'editor';
+DELETE FROM permissions WHERE name = 'books:update';
+
+UPDATE roles SET description = 'Maintains the catalog but cannot delete from it' WHERE name = 'librarian';
+UPDATE permissions SET description = 'Add books and upload book files' WHERE name = 'books:create';
+UPDATE permissions SET description = 'Delete books and book files' WHERE name = 'books:delete';
+UPDATE permissions SET description = 'Add categories' WHERE name = 'categories:create';
+UPDATE permissions SET description = 'Rename, move, reorder and hide categories' WHERE name = 'categories:update';
+UPDATE permissions SET description = 'Delete and merge categories' WHERE name = 'categories:delete';
+
+DROP INDEX IF EXISTS idx_books_created_by_user_id;
+DROP INDEX IF EXISTS idx_categories_created_by_user_id;
+ALTER TABLE books DROP COLUMN IF EXISTS created_by_user_id;
+ALTER TABLE categories DROP COLUMN IF EXISTS created_by_user_id;
@@ -0,0 +1,117 @@
+-- +migrate Up
+
+-- Organizations (tenants), e.g. library branches sharing one deployment. Each
+-- has its own users and catalog.
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(255),
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_by VARCHAR(255)
+);
+
+-- Existing data belongs to the default organization
+INSERT INTO organizations (name, slug, created_by, modified_by) VALUES
+    ('Default', 'default', 'system', 'system')
+ON CONFLICT (slug) DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+
+UPDATE users SET organization_id = (SELECT id FROM organizations WHERE slug = 'default') WHERE organization_id IS NULL;
+UPDATE categories SET organization_id = (SELECT id FROM organizations WHERE slug = 'default') WHERE organization_id IS NULL;
+UPDATE books SET organization_id = (SELECT id FROM organizations WHERE slug = 'default') WHERE organization_id IS NULL;
+
+ALTER TABLE users ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE categories ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE books ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_organization_id ON users(organization_id);
+CREATE INDEX IF NOT EXISTS idx_categories_organization_id ON categories(organization_id);
+CREATE INDEX IF NOT EXISTS idx_books_organization_id ON books(organization_id);
+
+-- Category names and slugs are unique per organization. Usernames stay
+-- unique across organizations since the login does not ask for one.
+DROP INDEX IF EXISTS uq_categories_name_normalized;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_categories_organization_name_normalized ON categories (organization_id, LOWER(TRIM(name)));
+
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS uq_categories_slug;
+ALTER TABLE categories ADD CONSTRAINT uq_categories_organization_slug UNIQUE (organization_id, slug);
+
+ALTER TABLE category_slug_history ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+UPDATE category_slug_history SET organization_id = categories.organization_id
+FROM categories
+WHERE categories.id = category_slug_history.category_id AND category_slug_history.organization_id IS NULL;
+ALTER TABLE category_slug_history ALTER COLUMN organization_id SET NOT NULL;
+ALTER TABLE category_slug_history DROP CONSTRAINT IF EXISTS category_slug_history_pkey;
+ALTER TABLE category_slug_history ADD PRIMARY KEY (organization_id, slug);
+
+-- Super administrators manage the organizations. Roles are shared by all
+-- organizations, so only they may change them.
+INSERT INTO permissions (name, description) VALUES
+    ('organizations:manage', 'Manage organizations, their first users and the shared roles')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO roles (name, description, created_by, modified_by) VALUES
+    ('super_admin', 'Full access in their own organization and manages all organizations', 'system', 'system')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_name, permission_name)
+SELECT 'super_admin', name FROM permissions
+ON CONFLICT DO NOTHING;
+
+-- Row-level security as a backstop for the organization filters in the
+-- queries. Statements run with app.organization_id set, which the API does
+-- for its writes, only see and write rows of that organization. Without the
+-- setting, e.g. for migrations and the admin CLI, all rows are visible.
+-- Superusers and roles with BYPASSRLS are never restricted.
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON users
+    USING (NULLIF(current_setting('app.organization_id', true), '') IS NULL
+           OR organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+ALTER TABLE categories ENABLE ROW LEVEL SECURITY;
+ALTER TABLE categories FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON categories
+    USING (NULLIF(current_setting('app.organization_id', true), '') IS NULL
+           OR organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+ALTER TABLE books ENABLE ROW LEVEL SECURITY;
+ALTER TABLE books FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON books
+    USING (NULLIF(current_setting('app.organization_id', true), '') IS NULL
+           OR organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+-- +migrate Down
+
+DROP POLICY IF EXISTS organization_isolation ON books;
+ALTER TABLE books NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE books DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS organization_isolation ON categories;
+ALTER TABLE categories NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE categories DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS organization_isolation ON users;
+ALTER TABLE users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+
+UPDATE users SET role = 'admin' WHERE role = 'super_admin';
+DELETE FROM roles WHERE name = 'super_admin';
+DELETE FROM permissions WHERE name = 'organizations:manage';
+
+ALTER TABLE category_slug_history DROP CONSTRAINT IF EXISTS category_slug_history_pkey;
+ALTER TABLE category_slug_history DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE category_slug_history ADD PRIMARY KEY (slug);
+
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS uq_categories_organization_slug;
+ALTER TABLE categories ADD CONSTRAINT uq_categories_slug UNIQUE (slug);
+DROP INDEX IF EXISTS uq_categories_organization_name_normalized;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_categories_name_normalized ON categories (LOWER(TRIM(name)));
+
+ALTER TABLE books DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE categories DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organizations;
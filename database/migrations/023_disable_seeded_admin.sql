@@ -0,0 +1,14 @@
+-- +migrate Up
+
+-- Older installations seeded an admin account with the well-known password
+-- admin123. Accounts still using that password are disabled, their sessions
+-- ended, and flagged so the password is changed once they are re-enabled with
+-- "admin reset-password".
+UPDATE users
+SET status = 'disabled', must_change_password = TRUE, token_version = token_version + 1,
+    modified_at = CURRENT_TIMESTAMP, modified_by = 'system'
+WHERE password = '$2a$10$6v4IMCcL8NZT/JSF9fSwr.fQx/zWzsBGJF8N9m3bj5RRS4HSPpjUy';
+
+-- +migrate Down
+
+-- Disabled accounts are left as they are
@@ -0,0 +1,86 @@
+-- +migrate Up
+
+-- Row-level security fails closed: without app.organization_id no rows are
+-- visible. The API sets it in a transaction for each request on organization
+-- data. Migrations, the admin commands and lookups across organizations
+-- connect with ADMIN_DATABASE_URL, as a role with BYPASSRLS.
+DROP POLICY IF EXISTS organization_isolation ON users;
+CREATE POLICY organization_isolation ON users
+    USING (organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+DROP POLICY IF EXISTS organization_isolation ON categories;
+CREATE POLICY organization_isolation ON categories
+    USING (organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+DROP POLICY IF EXISTS organization_isolation ON books;
+CREATE POLICY organization_isolation ON books
+    USING (organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+ALTER TABLE category_slug_history ENABLE ROW LEVEL SECURITY;
+ALTER TABLE category_slug_history FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON category_slug_history
+    USING (organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+-- Tables without an organization_id follow the book, user or list they
+-- belong to, whose own policy limits them to the organization
+ALTER TABLE book_files ENABLE ROW LEVEL SECURITY;
+ALTER TABLE book_files FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON book_files
+    USING (EXISTS (SELECT 1 FROM books WHERE books.id = book_files.book_id));
+
+ALTER TABLE reading_progress ENABLE ROW LEVEL SECURITY;
+ALTER TABLE reading_progress FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON reading_progress
+    USING (EXISTS (SELECT 1 FROM users WHERE users.id = reading_progress.user_id));
+
+ALTER TABLE reading_lists ENABLE ROW LEVEL SECURITY;
+ALTER TABLE reading_lists FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON reading_lists
+    USING (EXISTS (SELECT 1 FROM users WHERE users.id = reading_lists.user_id));
+
+ALTER TABLE reading_list_items ENABLE ROW LEVEL SECURITY;
+ALTER TABLE reading_list_items FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON reading_list_items
+    USING (EXISTS (SELECT 1 FROM reading_lists WHERE reading_lists.id = reading_list_items.list_id));
+
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON api_keys
+    USING (EXISTS (SELECT 1 FROM users WHERE users.id = api_keys.user_id));
+
+-- +migrate Down
+
+DROP POLICY IF EXISTS organization_isolation ON api_keys;
+ALTER TABLE api_keys NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE api_keys DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS organization_isolation ON reading_list_items;
+ALTER TABLE reading_list_items NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE reading_list_items DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS organization_isolation ON reading_lists;
+ALTER TABLE reading_lists NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE reading_lists DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS organization_isolation ON reading_progress;
+ALTER TABLE reading_progress NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE reading_progress DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS organization_isolation ON book_files;
+ALTER TABLE book_files NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE book_files DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS organization_isolation ON category_slug_history;
+ALTER TABLE category_slug_history NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE category_slug_history DISABLE ROW LEVEL SECURITY;
+
+-- Restore the policies that show all rows without the setting
+DROP POLICY IF EXISTS organization_isolation ON books;
+CREATE POLICY organization_isolation ON books
+    USING (NULLIF(current_setting('app.organization_id', true), '') IS NULL
+           OR organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+DROP POLICY IF EXISTS organization_isolation ON categories;
+CREATE POLICY organization_isolation ON categories
+    USING (NULLIF(current_setting('app.organization_id', true), '') IS NULL
+           OR organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
+
+DROP POLICY IF EXISTS organization_isolation ON users;
+CREATE POLICY organization_isolation ON users
+    USING (NULLIF(current_setting('app.organization_id', true), '') IS NULL
+           OR organization_id = NULLIF(current_setting('app.organization_id', true), '')::integer);
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+
+	"book-management-api/slug"
+)
+
+// backfillCategorySlugs gives categories without a slug one derived from their
+// name, numbered in ID order the way the API numbers new categories. Purely
+// numeric slugs left by earlier versions are replaced too, as they can never
+// be resolved. Once every category has a slug the column is made NOT NULL.
+func backfillCategorySlugs(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type pending struct {
+		id             int
+		organizationID int
+		name           string
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, organization_id, name FROM categories
+		WHERE slug IS NULL OR slug ~ '^[0-9]+$'
+		ORDER BY id
+		FOR UPDATE
+	`)
+	if err != nil {
+		return err
+	}
+	var categories []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.organizationID, &p.name); err != nil {
+			rows.Close()
+			return err
+		}
+		categories = append(categories, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(categories) > 0 {
+		// Slugs in use or kept for redirects, per organization
+		taken := map[int]map[string]bool{}
+		rows, err := tx.Query(`
+			SELECT organization_id, slug FROM categories WHERE slug IS NOT NULL AND slug !~ '^[0-9]+$'
+			UNION
+			SELECT organization_id, slug FROM category_slug_history
+		`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var organizationID int
+			var existing string
+			if err := rows.Scan(&organizationID, &existing); err != nil {
+				rows.Close()
+				return err
+			}
+			if taken[organizationID] == nil {
+				taken[organizationID] = map[string]bool{}
+			}
+			taken[organizationID][existing] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, p := range categories {
+			if taken[p.organizationID] == nil {
+				taken[p.organizationID] = map[string]bool{}
+			}
+			s := slug.Unique(slug.MakeOr(p.name, "category"), taken[p.organizationID])
+			taken[p.organizationID][s] = true
+
+			if _, err := tx.Exec("UPDATE categories SET slug = $1 WHERE id = $2", s, p.id); err != nil {
+				return err
+			}
+		}
+	}
+
+	var nullable string
+	err = tx.QueryRow(`
+		SELECT is_nullable FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'categories' AND column_name = 'slug'
+	`).Scan(&nullable)
+	if err != nil {
+		return err
+	}
+	if nullable == "YES" {
+		if _, err := tx.Exec("ALTER TABLE categories ALTER COLUMN slug SET NOT NULL"); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
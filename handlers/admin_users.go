@@ -0,0 +1,747 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/config"
+	"book-management-api/models"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type AdminUserHandler struct {
+	DB             *sql.DB
+	Cfg            *config.Config
+	PasswordPolicy *auth.PasswordPolicy
+}
+
+func NewAdminUserHandler(db *sql.DB, cfg *config.Config, passwordPolicy *auth.PasswordPolicy) *AdminUserHandler {
+	return &AdminUserHandler{
+		DB:             db,
+		Cfg:            cfg,
+		PasswordPolicy: passwordPolicy,
+	}
+}
+
+// GetAll lists the users of the organization, optionally filtered by a
+// username search (q), status and role, one page at a time
+func (h *AdminUserHandler) GetAll(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid page parameter",
+			Error:   "page must be a positive integer",
+		})
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid page_size parameter",
+			Error:   "page_size must be between 1 and 100",
+		})
+		return
+	}
+
+	// Empty filters match every user
+	filter := `
+		WHERE ($1 = '' OR username ILIKE '%' || $1 || '%')
+		  AND ($2 = '' OR status = $2)
+		  AND ($3 = '' OR role = $3)
+		  AND organization_id = $4
+	`
+	args := []interface{}{strings.TrimSpace(c.Query("q")), c.Query("status"), c.Query("role"), currentOrganizationID(c)}
+
+	var total int
+	if err := h.DB.QueryRow(`SELECT COUNT(*) FROM users `+filter, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to count users",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	rows, err := h.DB.Query(`SELECT `+userColumns+` FROM users `+filter+` ORDER BY id ASC LIMIT $5 OFFSET $6`,
+		append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch users",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan user",
+				Error:   err.Error(),
+			})
+			return
+		}
+		users = append(users, user)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Users retrieved successfully",
+		Data: models.PaginatedResponse{
+			Items:    users,
+			Page:     page,
+			PageSize: pageSize,
+			Total:    total,
+		},
+	})
+}
+
+func (h *AdminUserHandler) GetByID(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "User retrieved successfully",
+		Data:    user,
+	})
+}
+
+// Create adds an active account, for example for a new staff member. It
+// joins the caller's organization unless a super administrator picks another.
+func (h *AdminUserHandler) Create(c *gin.Context) {
+	var input models.AdminUserCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	input.Username = strings.TrimSpace(input.Username)
+	if input.Role == "" {
+		input.Role = "reader"
+	}
+
+	var problems []string
+	for _, problem := range auth.ValidateUsername(input.Username, h.Cfg.Registration.UsernameMinLength, h.Cfg.Registration.UsernameMaxLength) {
+		problems = append(problems, "username "+problem)
+	}
+	for _, problem := range h.PasswordPolicy.Validate(input.Password, input.Username) {
+		problems = append(problems, "password "+problem)
+	}
+
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid username or password",
+			Error:   strings.Join(problems, "; "),
+		})
+		return
+	}
+
+	if respondIfUnknownRole(c, h.DB, input.Role) || respondIfRoleReserved(c, h.DB, input.Role) {
+		return
+	}
+
+	organizationID, ok := h.organizationForNewUser(c, input.OrganizationID)
+	if !ok {
+		return
+	}
+
+	if h.respondIfUsernameTaken(c, input.Username, 0) {
+		return
+	}
+
+	email := normalizeEmail(input.Email)
+	if respondIfEmailTaken(c, h.DB, email, 0) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to hash password",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	var user models.User
+	err = scanUser(h.DB.QueryRow(`
+		INSERT INTO users (username, email, password, role, status, organization_id, created_by, modified_by)
+		VALUES ($1, $2, $3, $4, 'active', $5, $6, $6)
+		RETURNING `+userColumns,
+		input.Username, email, string(hashedPassword), input.Role, organizationID, username), &user)
+
+	if isUniqueViolation(err) {
+		h.respondConflict(c, input.Username, email, 0)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "User created successfully",
+		Data:    user,
+	})
+}
+
+// Update changes the username, email and/or role of a user. Changing the role ends
+// the user's sessions since their tokens carry the old permissions.
+func (h *AdminUserHandler) Update(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok || respondIfRoleReserved(c, h.DB, user.Role) {
+		return
+	}
+
+	var input models.AdminUserUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if input.Username != nil {
+		newUsername := strings.TrimSpace(*input.Username)
+		if problems := auth.ValidateUsername(newUsername, h.Cfg.Registration.UsernameMinLength, h.Cfg.Registration.UsernameMaxLength); len(problems) > 0 && newUsername != user.Username {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid username",
+				Error:   "username " + strings.Join(problems, "; username "),
+			})
+			return
+		}
+
+		if h.respondIfUsernameTaken(c, newUsername, user.ID) {
+			return
+		}
+		user.Username = newUsername
+	}
+
+	if input.Email != nil {
+		user.Email = normalizeEmail(*input.Email)
+		if respondIfEmailTaken(c, h.DB, user.Email, user.ID) {
+			return
+		}
+	}
+
+	if input.Role != nil {
+		if *input.Role != "admin" && h.isCurrentUser(c, user.ID) {
+			respondCannotChangeOwnAccount(c, "remove your own admin role")
+			return
+		}
+		if respondIfUnknownRole(c, h.DB, *input.Role) || respondIfRoleReserved(c, h.DB, *input.Role) {
+			return
+		}
+		user.Role = *input.Role
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	err := scanUser(h.DB.QueryRow(`
+		UPDATE users
+		SET username = $1, email = $2, role = $3, modified_at = CURRENT_TIMESTAMP, modified_by = $4,
+			token_version = token_version + CASE WHEN role <> $3 THEN 1 ELSE 0 END
+		WHERE id = $5
+		RETURNING `+userColumns,
+		user.Username, user.Email, user.Role, username, user.ID), user)
+
+	if isUniqueViolation(err) {
+		h.respondConflict(c, user.Username, user.Email, user.ID)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "User updated successfully",
+		Data:    user,
+	})
+}
+
+// Disable blocks an account from logging in and ends its sessions
+func (h *AdminUserHandler) Disable(c *gin.Context) {
+	h.setStatus(c, "disabled", "User disabled successfully")
+}
+
+// Enable reactivates a disabled account
+func (h *AdminUserHandler) Enable(c *gin.Context) {
+	h.setStatus(c, "active", "User enabled successfully")
+}
+
+func (h *AdminUserHandler) setStatus(c *gin.Context, status, message string) {
+	user, ok := h.findUser(c)
+	if !ok || respondIfRoleReserved(c, h.DB, user.Role) {
+		return
+	}
+
+	if status != "active" && h.isCurrentUser(c, user.ID) {
+		respondCannotChangeOwnAccount(c, "disable your own account")
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	err := scanUser(h.DB.QueryRow(`
+		UPDATE users
+		SET status = $1, modified_at = CURRENT_TIMESTAMP, modified_by = $2, token_version = token_version + 1
+		WHERE id = $3
+		RETURNING `+userColumns,
+		status, username, user.ID), user)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update user status",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    user,
+	})
+}
+
+// Delete removes an account. The deletion is kept in audit_logs since the
+// row itself is gone afterwards.
+func (h *AdminUserHandler) Delete(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok || respondIfRoleReserved(c, h.DB, user.Role) {
+		return
+	}
+
+	if h.isCurrentUser(c, user.ID) {
+		respondCannotChangeOwnAccount(c, "delete your own account")
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	tx, err := beginTenantTx(c, h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM users WHERE id = $1 AND organization_id = $2", user.ID, currentOrganizationID(c)); err == nil {
+		err = recordAudit(tx, "user", user.ID, "delete", gin.H{"username": user.Username, "role": user.Role}, username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "User deleted successfully",
+	})
+}
+
+// ResetPassword sets a temporary password and forces the user to choose a new
+// one. Without a password in the request a random one is generated and
+// returned once. Existing sessions of the user end.
+func (h *AdminUserHandler) ResetPassword(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok || respondIfRoleReserved(c, h.DB, user.Role) {
+		return
+	}
+
+	var input models.AdminPasswordResetInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	response := models.AdminPasswordResetResponse{}
+	password := input.Password
+	if password == "" {
+		generated, err := generateToken(12)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to generate password",
+				Error:   err.Error(),
+			})
+			return
+		}
+		password = generated
+		response.TemporaryPassword = generated
+	} else if problems := h.PasswordPolicy.Validate(password, user.Username); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid password",
+			Error:   "password " + strings.Join(problems, "; password "),
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to hash password",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	err = scanUser(h.DB.QueryRow(`
+		UPDATE users
+		SET password = $1, must_change_password = TRUE, modified_at = CURRENT_TIMESTAMP, modified_by = $2,
+			token_version = token_version + 1
+		WHERE id = $3
+		RETURNING `+userColumns,
+		string(hashedPassword), username, user.ID), user)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reset password",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	response.User = *user
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password reset successfully",
+		Data:    response,
+	})
+}
+
+// GetPending lists registrations to the organization that still wait for
+// approval
+func (h *AdminUserHandler) GetPending(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT `+userColumns+`
+		FROM users
+		WHERE status = 'pending' AND organization_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, currentOrganizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch users",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan user",
+				Error:   err.Error(),
+			})
+			return
+		}
+		users = append(users, user)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Pending users retrieved successfully",
+		Data:    users,
+	})
+}
+
+// Approve activates a pending registration
+func (h *AdminUserHandler) Approve(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid user ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	var user models.User
+	err = scanUser(h.DB.QueryRow(`
+		UPDATE users
+		SET status = 'active', approved_at = CURRENT_TIMESTAMP, approved_by = $1,
+			modified_at = CURRENT_TIMESTAMP, modified_by = $1
+		WHERE id = $2 AND status = 'pending' AND organization_id = $3
+		RETURNING `+userColumns,
+		username, id, currentOrganizationID(c)), &user)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Pending user not found",
+			Error:   "no pending registration exists for the specified ID",
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to approve user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "User approved successfully",
+		Data:    user,
+	})
+}
+
+// Reject deletes a pending registration
+func (h *AdminUserHandler) Reject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid user ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.DB.Exec("DELETE FROM users WHERE id = $1 AND status = 'pending' AND organization_id = $2",
+		id, currentOrganizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reject user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Pending user not found",
+			Error:   "no pending registration exists for the specified ID",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "User registration rejected",
+	})
+}
+
+// findUser loads the user addressed by the :id route parameter. Users of
+// other organizations are reported as not found.
+func (h *AdminUserHandler) findUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid user ID",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	var user models.User
+	err = scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1 AND organization_id = $2`,
+		id, currentOrganizationID(c)), &user)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "User not found",
+			Error:   "user with specified ID does not exist",
+		})
+		return nil, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch user",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// organizationForNewUser returns the organization a new account joins:
+// requested when given by a super administrator, else the caller's. It writes
+// a response and returns false when the request cannot go on.
+func (h *AdminUserHandler) organizationForNewUser(c *gin.Context, requested *int) (int, bool) {
+	if requested == nil || *requested == currentOrganizationID(c) {
+		return currentOrganizationID(c), true
+	}
+
+	if !hasPermission(c, "organizations:manage") {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Insufficient permissions",
+			Error:   "only users with the permission organizations:manage may add users to other organizations",
+		})
+		return 0, false
+	}
+
+	var exists bool
+	err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM organizations WHERE id = $1)", *requested).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return 0, false
+	}
+
+	if !exists {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid organization ID",
+			Error:   "organization with specified ID does not exist",
+		})
+		return 0, false
+	}
+	return *requested, true
+}
+
+// respondIfUsernameTaken writes a 409 response when another user already has
+// username, compared case-insensitively. It reports whether a response was
+// written.
+func (h *AdminUserHandler) respondIfUsernameTaken(c *gin.Context, username string, excludeID int) bool {
+	var taken bool
+	err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1) AND id <> $2)", username, excludeID).Scan(&taken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return true
+	}
+
+	if taken {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Username already taken",
+			Error:   "a user with this username already exists",
+		})
+		return true
+	}
+	return false
+}
+
+// respondConflict explains a unique violation raised while saving a user
+func (h *AdminUserHandler) respondConflict(c *gin.Context, username string, email *string, excludeID int) {
+	if h.respondIfUsernameTaken(c, username, excludeID) || respondIfEmailTaken(c, h.DB, email, excludeID) {
+		return
+	}
+
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Message: "User already exists",
+		Error:   "a user with this username or email already exists",
+	})
+}
+
+func (h *AdminUserHandler) isCurrentUser(c *gin.Context, userID int) bool {
+	currentID, ok := currentUserID(c)
+	return ok && currentID == userID
+}
+
+func respondCannotChangeOwnAccount(c *gin.Context, action string) {
+	c.JSON(http.StatusBadRequest, models.APIResponse{
+		Success: false,
+		Message: "Cannot modify own account",
+		Error:   "administrators cannot " + action,
+	})
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/models"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Prefix of every API key, so leaked keys are easy to recognize
+const apiKeyPrefix = "bma_"
+
+type APIKeyHandler struct {
+	DB *sql.DB
+}
+
+func NewAPIKeyHandler(db *sql.DB) *APIKeyHandler {
+	return &APIKeyHandler{DB: db}
+}
+
+const apiKeyColumns = `id, user_id, name, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_at, created_by`
+
+func scanAPIKey(row rowScanner, key *models.APIKey) error {
+	return row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+		&key.CreatedBy,
+	)
+}
+
+// GetAll lists the authenticated user's API keys that have not been revoked
+func (h *APIKeyHandler) GetAll(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch API keys",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan API key",
+				Error:   err.Error(),
+			})
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API keys retrieved successfully",
+		Data:    keys,
+	})
+}
+
+// Create issues a new API key. The key is part of this response only; the
+// database keeps just its hash.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.APIKeyCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid expiry",
+				Error:   "expires_at must be in the future",
+			})
+			return
+		}
+		expiresAt := input.ExpiresAt.UTC()
+		input.ExpiresAt = &expiresAt
+	}
+
+	// A key cannot do more than its owner
+	permissions, _ := c.Get("permissions")
+	owned, _ := permissions.([]string)
+	granted := map[string]bool{}
+	for _, permission := range owned {
+		granted[permission] = true
+	}
+	for _, scope := range input.Scopes {
+		if !granted[scope] {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid scope",
+				Error:   "scope '" + scope + "' is not a permission of your role",
+			})
+			return
+		}
+	}
+
+	secret, err := generateToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate API key",
+			Error:   err.Error(),
+		})
+		return
+	}
+	key := apiKeyPrefix + secret
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	var response models.APIKeyCreateResponse
+	err = scanAPIKey(tx.QueryRow(`
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiKeyColumns,
+		userID, input.Name, key[:len(apiKeyPrefix)+6], auth.HashToken(key), pq.Array(input.Scopes), input.ExpiresAt, username), &response.APIKey)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create API key",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	response.Key = key
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "API key created successfully, store the key now as it is not shown again",
+		Data:    response,
+	})
+}
+
+// Revoke disables one of the authenticated user's API keys
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid API key ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to revoke API key",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "API key not found",
+			Error:   "API key with specified ID does not exist",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API key revoked successfully",
+	})
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// recordAudit writes an audit_logs entry as part of tx, so the entry is only
+// kept when the audited change is committed
+func recordAudit(tx *sql.Tx, entityType string, entityID int, action string, details interface{}, username interface{}) error {
+	payload, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO audit_logs (entity_type, entity_id, action, details, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+	`, entityType, entityID, action, string(payload), username)
+	return err
+}
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"book-management-api/config"
+	"book-management-api/models"
+	"book-management-api/storage"
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BookFileHandler struct {
+	DB      *sql.DB
+	Storage storage.Storage
+	Cfg     *config.Config
+}
+
+func NewBookFileHandler(db *sql.DB, store storage.Storage, cfg *config.Config) *BookFileHandler {
+	return &BookFileHandler{
+		DB:      db,
+		Storage: store,
+		Cfg:     cfg,
+	}
+}
+
+// Supported ebook formats and the content type each one is served with
+var bookFileContentTypes = map[string]string{
+	"epub": "application/epub+zip",
+	"pdf":  "application/pdf",
+}
+
+// detectBookFileFormat sniffs the leading bytes of an upload. EPUB files are ZIP
+// archives whose first entry is an uncompressed "mimetype" file.
+func detectBookFileFormat(header []byte) string {
+	if bytes.HasPrefix(header, []byte("%PDF-")) {
+		return "pdf"
+	}
+	if bytes.HasPrefix(header, []byte("PK\x03\x04")) && len(header) >= 58 &&
+		string(header[30:38]) == "mimetype" && string(header[38:58]) == "application/epub+zip" {
+		return "epub"
+	}
+	return ""
+}
+
+func (h *BookFileHandler) Upload(c *gin.Context) {
+	// Limit the body before anything can read it
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.Cfg.Storage.MaxUploadSize)
+
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Uploading edits the book, so it follows the ownership policy for updates.
+	// The transaction is not held open while the file is received.
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	ownerID, err := ownedBooks.owner(c, tx, bookID)
+	tx.Rollback()
+	if err != nil {
+		ownedBooks.respondOwnerLookup(c, err)
+		return
+	}
+
+	if ownedBooks.respondIfNotAllowed(c, actionUpdate, ownerID) {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid file upload",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid file upload",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer src.Close()
+
+	reader := bufio.NewReaderSize(src, 512)
+	header, _ := reader.Peek(64)
+	format := detectBookFileFormat(header)
+	if format == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Unsupported file type",
+			Error:   "only EPUB and PDF files are supported",
+		})
+		return
+	}
+
+	saved, err := h.Storage.Save(fmt.Sprintf("books/%d", bookID), "."+format, reader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to store file",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Optionally verify the checksum computed by the client
+	if expected := strings.ToLower(strings.TrimSpace(c.PostForm("sha256"))); expected != "" && expected != saved.SHA256 {
+		h.removeStoredFile(saved.Key)
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "File integrity check failed",
+			Error:   "sha256 of uploaded file does not match the provided checksum",
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	fileName := filepath.Base(fileHeader.Filename)
+	if fileName == "." || fileName == string(filepath.Separator) {
+		fileName = fmt.Sprintf("book-%d.%s", bookID, format)
+	}
+
+	file := models.BookFile{
+		BookID:      bookID,
+		Format:      format,
+		FileName:    fileName,
+		ContentType: bookFileContentTypes[format],
+		SizeBytes:   saved.Size,
+		SHA256:      saved.SHA256,
+		StorageKey:  saved.Key,
+	}
+
+	tx, ok = tenantTx(c, h.DB)
+	if !ok {
+		h.removeStoredFile(saved.Key)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO book_files (book_id, format, file_name, content_type, size_bytes, sha256, storage_key, created_by, modified_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, modified_at
+	`, file.BookID, file.Format, file.FileName, file.ContentType, file.SizeBytes, file.SHA256, file.StorageKey, username, username).Scan(
+		&file.ID,
+		&file.CreatedAt,
+		&file.ModifiedAt,
+	)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		h.removeStoredFile(saved.Key)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to save file metadata",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	usernameStr := username.(string)
+	file.CreatedBy = &usernameStr
+	file.ModifiedBy = &usernameStr
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "File uploaded successfully",
+		Data:    file,
+	})
+}
+
+func (h *BookFileHandler) GetAll(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	// Files of missing books are a 404 rather than an empty list
+	if _, err := ownedBooks.owner(c, tx, bookID); err != nil {
+		ownedBooks.respondOwnerLookup(c, err)
+		return
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, book_id, format, file_name, content_type, size_bytes, sha256, storage_key,
+			   created_at, created_by, modified_at, modified_by
+		FROM book_files
+		WHERE book_id = $1 AND book_id IN (SELECT id FROM books WHERE organization_id = $2)
+		ORDER BY id ASC
+	`, bookID, currentOrganizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch files",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	files := []models.BookFile{}
+	for rows.Next() {
+		var file models.BookFile
+		err := rows.Scan(
+			&file.ID,
+			&file.BookID,
+			&file.Format,
+			&file.FileName,
+			&file.ContentType,
+			&file.SizeBytes,
+			&file.SHA256,
+			&file.StorageKey,
+			&file.CreatedAt,
+			&file.CreatedBy,
+			&file.ModifiedAt,
+			&file.ModifiedBy,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan file",
+				Error:   err.Error(),
+			})
+			return
+		}
+		files = append(files, file)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Files retrieved successfully",
+		Data:    files,
+	})
+}
+
+// Download streams a stored file. Range and If-Range are handled by
+// http.ServeContent, using the SHA-256 as a strong ETag.
+func (h *BookFileHandler) Download(c *gin.Context) {
+	// Only the lookup runs in the transaction, not the transfer
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	file, ok := h.findFile(c, tx)
+	tx.Rollback()
+	if !ok {
+		return
+	}
+
+	content, err := h.Storage.Open(file.StorageKey)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "File not found",
+			Error:   "file content is missing from storage",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to open file",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer content.Close()
+
+	digest, _ := hex.DecodeString(file.SHA256)
+
+	c.Header("Content-Type", file.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.FileName}))
+	c.Header("ETag", `"`+file.SHA256+`"`)
+	c.Header("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest)+":")
+	c.Header("Cache-Control", "private, no-transform")
+
+	http.ServeContent(c.Writer, c.Request, file.FileName, file.CreatedAt, content)
+}
+
+// Delete removes a file. Like deleting the book, this is reserved for its
+// owner and users with books:delete.
+func (h *BookFileHandler) Delete(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	file, ok := h.findFile(c, tx)
+	if !ok {
+		return
+	}
+
+	ownerID, err := ownedBooks.owner(c, tx, file.BookID)
+	if err != nil {
+		ownedBooks.respondOwnerLookup(c, err)
+		return
+	}
+
+	if ownedBooks.respondIfNotAllowed(c, actionDelete, ownerID) {
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM book_files WHERE id = $1", file.ID)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete file",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	h.removeStoredFile(file.StorageKey)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "File deleted successfully",
+	})
+}
+
+// findFile loads the file addressed by the :id and :fileId route parameters,
+// writing an error response when it cannot
+func (h *BookFileHandler) findFile(c *gin.Context, q rowQueryer) (*models.BookFile, bool) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	fileID, err := strconv.Atoi(c.Param("fileId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid file ID",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	var file models.BookFile
+	err = q.QueryRow(`
+		SELECT id, book_id, format, file_name, content_type, size_bytes, sha256, storage_key,
+			   created_at, created_by, modified_at, modified_by
+		FROM book_files
+		WHERE id = $1 AND book_id = $2 AND book_id IN (SELECT id FROM books WHERE organization_id = $3)
+	`, fileID, bookID, currentOrganizationID(c)).Scan(
+		&file.ID,
+		&file.BookID,
+		&file.Format,
+		&file.FileName,
+		&file.ContentType,
+		&file.SizeBytes,
+		&file.SHA256,
+		&file.StorageKey,
+		&file.CreatedAt,
+		&file.CreatedBy,
+		&file.ModifiedAt,
+		&file.ModifiedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "File not found",
+			Error:   "file with specified ID does not exist for this book",
+		})
+		return nil, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch file",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	return &file, true
+}
+
+func (h *BookFileHandler) removeStoredFile(key string) {
+	if err := h.Storage.Delete(key); err != nil {
+		log.Printf("Failed to remove stored file %s: %v", key, err)
+	}
+}
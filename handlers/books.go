@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"book-management-api/models"
+	"book-management-api/storage"
 	"database/sql"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -10,23 +12,34 @@ import (
 )
 
 type BookHandler struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Storage storage.Storage
 }
 
-func NewBookHandler(db *sql.DB) *BookHandler {
-	return &BookHandler{DB: db}
+func NewBookHandler(db *sql.DB, store storage.Storage) *BookHandler {
+	return &BookHandler{
+		DB:      db,
+		Storage: store,
+	}
 }
 
 func (h *BookHandler) GetAll(c *gin.Context) {
-	rows, err := h.DB.Query(`
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
 		SELECT b.id, b.title, b.description, b.image_url, b.release_year, 
 			   b.price, b.total_page, b.thickness, b.category_id,
-			   b.created_at, b.created_by, b.modified_at, b.modified_by,
+			   b.created_at, b.created_by, b.created_by_user_id, b.modified_at, b.modified_by,
 			   c.name as category_name
 		FROM books b
 		LEFT JOIN categories c ON b.category_id = c.id
+		WHERE b.organization_id = $1
 		ORDER BY b.id ASC
-	`)
+	`, currentOrganizationID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -54,6 +67,7 @@ func (h *BookHandler) GetAll(c *gin.Context) {
 			&book.CategoryID,
 			&book.CreatedAt,
 			&book.CreatedBy,
+			&book.CreatedByUserID,
 			&book.ModifiedAt,
 			&book.ModifiedBy,
 			&categoryName,
@@ -92,18 +106,24 @@ func (h *BookHandler) GetByID(c *gin.Context) {
 		return
 	}
 
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
 	var book models.Book
 	var categoryName sql.NullString
 	
-	err = h.DB.QueryRow(`
+	err = tx.QueryRow(`
 		SELECT b.id, b.title, b.description, b.image_url, b.release_year, 
 			   b.price, b.total_page, b.thickness, b.category_id,
-			   b.created_at, b.created_by, b.modified_at, b.modified_by,
+			   b.created_at, b.created_by, b.created_by_user_id, b.modified_at, b.modified_by,
 			   c.name as category_name
 		FROM books b
 		LEFT JOIN categories c ON b.category_id = c.id
-		WHERE b.id = $1
-	`, id).Scan(
+		WHERE b.id = $1 AND b.organization_id = $2
+	`, id, currentOrganizationID(c)).Scan(
 		&book.ID,
 		&book.Title,
 		&book.Description,
@@ -115,6 +135,7 @@ func (h *BookHandler) GetByID(c *gin.Context) {
 		&book.CategoryID,
 		&book.CreatedAt,
 		&book.CreatedBy,
+		&book.CreatedByUserID,
 		&book.ModifiedAt,
 		&book.ModifiedBy,
 		&categoryName,
@@ -160,52 +181,46 @@ func (h *BookHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// Validate category exists if provided
-	if bookInput.CategoryID != nil {
-		var categoryExists bool
-		err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", *bookInput.CategoryID).Scan(&categoryExists)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.APIResponse{
-				Success: false,
-				Message: "Failed to validate category",
-				Error:   err.Error(),
-			})
-			return
-		}
-
-		if !categoryExists {
-			c.JSON(http.StatusBadRequest, models.APIResponse{
-				Success: false,
-				Message: "Invalid category ID",
-				Error:   "category with specified ID does not exist",
-			})
-			return
-		}
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
 	}
+	defer tx.Rollback()
 
-	// Determine thickness based on total_page
-	thickness := "tipis"
-	if bookInput.TotalPage > 100 {
-		thickness = "tebal"
+	// Validate category exists if provided
+	if !h.validateCategory(c, tx, bookInput.CategoryID) {
+		return
 	}
 
+	thickness := bookThickness(bookInput.TotalPage)
+
 	username, exists := c.Get("username")
 	if !exists {
 		username = "system"
 	}
 
 	var book models.Book
-	err := h.DB.QueryRow(`
-		INSERT INTO books (title, description, image_url, release_year, price, total_page, thickness, category_id, created_by, modified_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) 
+	book.CreatedByUserID = ownerOf(c)
+	err := tx.QueryRow(`
+		INSERT INTO books (title, description, image_url, release_year, price, total_page, thickness, category_id, created_by, created_by_user_id, modified_by, organization_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) 
 		RETURNING id, created_at, modified_at
 	`, bookInput.Title, bookInput.Description, bookInput.ImageURL, bookInput.ReleaseYear, 
-	   bookInput.Price, bookInput.TotalPage, thickness, bookInput.CategoryID, username, username).Scan(
+	   bookInput.Price, bookInput.TotalPage, thickness, bookInput.CategoryID, username, book.CreatedByUserID, username,
+	   currentOrganizationID(c)).Scan(
 		&book.ID,
 		&book.CreatedAt,
 		&book.ModifiedAt,
 	)
 
+	// Get category name if category_id is provided
+	if err == nil && bookInput.CategoryID != nil {
+		err = categoryName(tx, *bookInput.CategoryID, &book.CategoryName)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -228,15 +243,6 @@ func (h *BookHandler) Create(c *gin.Context) {
 	book.CreatedBy = &usernameStr
 	book.ModifiedBy = &usernameStr
 
-	// Get category name if category_id is provided
-	if bookInput.CategoryID != nil {
-		var categoryName string
-		err := h.DB.QueryRow("SELECT name FROM categories WHERE id = $1", *bookInput.CategoryID).Scan(&categoryName)
-		if err == nil {
-			book.CategoryName = categoryName
-		}
-	}
-
 	c.JSON(http.StatusCreated, models.APIResponse{
 		Success: true,
 		Message: "Book created successfully",
@@ -244,7 +250,9 @@ func (h *BookHandler) Create(c *gin.Context) {
 	})
 }
 
-func (h *BookHandler) Delete(c *gin.Context) {
+// Update replaces the editable fields of a book. Owners may edit their own
+// books, users with books:update every book.
+func (h *BookHandler) Update(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -255,49 +263,239 @@ func (h *BookHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	// Check if book exists
-	var exists bool
-	err = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM books WHERE id = $1)", id).Scan(&exists)
+	var bookInput models.BookInput
+	if err := c.ShouldBindJSON(&bookInput); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	if !h.validateCategory(c, tx, bookInput.CategoryID) {
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	ownerID, err := ownedBooks.owner(c, tx, id)
+	if err != nil {
+		ownedBooks.respondOwnerLookup(c, err)
+		return
+	}
+
+	if ownedBooks.respondIfNotAllowed(c, actionUpdate, ownerID) {
+		return
+	}
+
+	book := models.Book{
+		ID:          id,
+		Title:       bookInput.Title,
+		Description: bookInput.Description,
+		ImageURL:    bookInput.ImageURL,
+		ReleaseYear: bookInput.ReleaseYear,
+		Price:       bookInput.Price,
+		TotalPage:   bookInput.TotalPage,
+		Thickness:   bookThickness(bookInput.TotalPage),
+		CategoryID:  bookInput.CategoryID,
+	}
+	err = tx.QueryRow(`
+		UPDATE books
+		SET title = $1, description = $2, image_url = $3, release_year = $4, price = $5, total_page = $6,
+			thickness = $7, category_id = $8, modified_at = CURRENT_TIMESTAMP, modified_by = $9
+		WHERE id = $10 AND organization_id = $11
+		RETURNING created_at, created_by, created_by_user_id, modified_at, modified_by
+	`, book.Title, book.Description, book.ImageURL, book.ReleaseYear, book.Price, book.TotalPage,
+		book.Thickness, book.CategoryID, username, id, currentOrganizationID(c)).Scan(
+		&book.CreatedAt,
+		&book.CreatedBy,
+		&book.CreatedByUserID,
+		&book.ModifiedAt,
+		&book.ModifiedBy,
+	)
+	if err == nil && book.CategoryID != nil {
+		err = categoryName(tx, *book.CategoryID, &book.CategoryName)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to check book existence",
+			Message: "Failed to update book",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	if !exists {
-		c.JSON(http.StatusNotFound, models.APIResponse{
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Book updated successfully",
+		Data:    book,
+	})
+}
+
+// TransferOwnership makes another user the owner of a book
+func (h *BookHandler) TransferOwnership(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Book not found",
-			Error:   "book with specified ID does not exist",
+			Message: "Invalid book ID",
+			Error:   err.Error(),
 		})
 		return
 	}
 
-	result, err := h.DB.Exec("DELETE FROM books WHERE id = $1", id)
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	ownedBooks.transferOwnership(c, tx, id)
+}
+
+// Delete removes a book and its files. Owners may delete their own books,
+// users with books:delete every book.
+func (h *BookHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the book so its owner cannot change before it is deleted
+	ownerID, err := ownedBooks.owner(c, tx, id)
+	if err != nil {
+		ownedBooks.respondOwnerLookup(c, err)
+		return
+	}
+
+	if ownedBooks.respondIfNotAllowed(c, actionDelete, ownerID) {
+		return
+	}
+
+	// Remember attached files, their rows are removed by ON DELETE CASCADE
+	storageKeys, err := fileStorageKeys(tx, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to delete book",
+			Message: "Failed to fetch book files",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.APIResponse{
+	_, err = tx.Exec("DELETE FROM books WHERE id = $1 AND organization_id = $2", id, currentOrganizationID(c))
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Book not found",
-			Error:   "book with specified ID does not exist",
+			Message: "Failed to delete book",
+			Error:   err.Error(),
 		})
 		return
 	}
 
+	for _, key := range storageKeys {
+		if err := h.Storage.Delete(key); err != nil {
+			log.Printf("Failed to remove stored file %s: %v", key, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "Book deleted successfully",
 	})
-}
\ No newline at end of file
+}
+
+func fileStorageKeys(q queryer, bookID int) ([]string, error) {
+	rows, err := q.Query("SELECT storage_key FROM book_files WHERE book_id = $1", bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// categoryName reads the name of category id into name. A category that
+// disappeared in the meantime leaves name empty.
+func categoryName(q rowQueryer, id int, name *string) error {
+	err := q.QueryRow("SELECT name FROM categories WHERE id = $1", id).Scan(name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// validateCategory checks that the category of a book exists, writing an error
+// response when it does not. A nil categoryID is valid.
+func (h *BookHandler) validateCategory(c *gin.Context, q rowQueryer, categoryID *int) bool {
+	if categoryID == nil {
+		return true
+	}
+
+	var categoryExists bool
+	err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1 AND organization_id = $2)",
+		*categoryID, currentOrganizationID(c)).Scan(&categoryExists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to validate category",
+			Error:   err.Error(),
+		})
+		return false
+	}
+
+	if !categoryExists {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid category ID",
+			Error:   "category with specified ID does not exist",
+		})
+		return false
+	}
+	return true
+}
+
+// bookThickness classifies a book by its page count
+func bookThickness(totalPage int) string {
+	if totalPage > 100 {
+		return "tebal"
+	}
+	return "tipis"
+}
@@ -2,27 +2,128 @@ package handlers
 
 import (
 	"book-management-api/models"
+	"book-management-api/slug"
 	"database/sql"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 )
 
 type CategoryHandler struct {
 	DB *sql.DB
+
+	// PublicOnly hides categories that are not visible, or that sit below a
+	// hidden parent, for the public storefront routes
+	PublicOnly bool
 }
 
 func NewCategoryHandler(db *sql.DB) *CategoryHandler {
 	return &CategoryHandler{DB: db}
 }
 
+func NewPublicCategoryHandler(db *sql.DB) *CategoryHandler {
+	return &CategoryHandler{
+		DB:         db,
+		PublicOnly: true,
+	}
+}
+
+// visibleCondition returns an SQL condition on the category ID in column that
+// only holds for categories the handler may show
+func (h *CategoryHandler) visibleCondition(column string) string {
+	if !h.PublicOnly {
+		return "TRUE"
+	}
+	return column + ` IN (
+		WITH RECURSIVE visible AS (
+			SELECT id FROM categories WHERE parent_id IS NULL AND is_visible
+			UNION
+			SELECT child.id FROM categories child JOIN visible ON child.parent_id = visible.id WHERE child.is_visible
+		)
+		SELECT id FROM visible
+	)`
+}
+
+// Sort keys accepted by GetAll. The metric keys need the stats columns.
+var categorySortColumns = map[string]string{
+	"position":            "c.position",
+	"id":                  "c.id",
+	"name":                "LOWER(c.name)",
+	"book_count":          "book_count",
+	"average_price":       "average_price",
+	"newest_release_year": "newest_release_year",
+	"last_modified_book":  "last_book_modified_at",
+}
+
+// GetAll lists categories. With ?with=stats every category also carries book
+// metrics, computed in one grouped query. ?sort and ?order pick the ordering.
 func (h *CategoryHandler) GetAll(c *gin.Context) {
-	rows, err := h.DB.Query(`
-		SELECT id, name, created_at, created_by, modified_at, modified_by 
-		FROM categories 
-		ORDER BY id ASC
-	`)
+	withStats := false
+	for _, with := range strings.Split(c.Query("with"), ",") {
+		if strings.TrimSpace(with) == "stats" {
+			withStats = true
+		}
+	}
+
+	sortKey := c.DefaultQuery("sort", "position")
+	sortColumn, ok := categorySortColumns[sortKey]
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid sort parameter",
+			Error:   "sort must be one of position, id, name, book_count, average_price, newest_release_year or last_modified_book",
+		})
+		return
+	}
+	if sortKey != "position" && sortKey != "id" && sortKey != "name" {
+		withStats = true
+	}
+
+	order := strings.ToUpper(c.DefaultQuery("order", "asc"))
+	if order != "ASC" && order != "DESC" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid order parameter",
+			Error:   "order must be asc or desc",
+		})
+		return
+	}
+
+	query := `
+		SELECT c.id, c.name, c.slug, c.parent_id, c.position, c.is_visible, c.created_at, c.created_by, c.created_by_user_id, c.modified_at, c.modified_by
+		FROM categories c
+		WHERE c.organization_id = $1 AND ` + h.visibleCondition("c.id") + `
+	`
+	if withStats {
+		query = `
+			SELECT c.id, c.name, c.slug, c.parent_id, c.position, c.is_visible, c.created_at, c.created_by, c.created_by_user_id, c.modified_at, c.modified_by,
+				   COUNT(b.id) AS book_count,
+				   AVG(b.price)::float8 AS average_price,
+				   MAX(b.release_year) AS newest_release_year,
+				   (ARRAY_AGG(b.id ORDER BY b.modified_at DESC NULLS LAST, b.id DESC) FILTER (WHERE b.id IS NOT NULL))[1] AS last_book_id,
+				   (ARRAY_AGG(b.title ORDER BY b.modified_at DESC NULLS LAST, b.id DESC) FILTER (WHERE b.id IS NOT NULL))[1] AS last_book_title,
+				   MAX(b.modified_at) AS last_book_modified_at
+			FROM categories c
+			LEFT JOIN books b ON b.category_id = c.id
+			WHERE c.organization_id = $1 AND ` + h.visibleCondition("c.id") + `
+			GROUP BY c.id
+		`
+	}
+	query += ` ORDER BY ` + sortColumn + ` ` + order + ` NULLS LAST, c.id ASC`
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, currentOrganizationID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -36,15 +137,36 @@ func (h *CategoryHandler) GetAll(c *gin.Context) {
 	var categories []models.Category
 	for rows.Next() {
 		var category models.Category
-		err := rows.Scan(
+		dest := []interface{}{
 			&category.ID,
 			&category.Name,
+			&category.Slug,
+			&category.ParentID,
+			&category.Position,
+			&category.IsVisible,
 			&category.CreatedAt,
 			&category.CreatedBy,
+			&category.CreatedByUserID,
 			&category.ModifiedAt,
 			&category.ModifiedBy,
-		)
-		if err != nil {
+		}
+
+		var stats models.CategoryStats
+		var lastBookID sql.NullInt64
+		var lastBookTitle sql.NullString
+		var lastBookModifiedAt *time.Time
+		if withStats {
+			dest = append(dest,
+				&stats.BookCount,
+				&stats.AveragePrice,
+				&stats.NewestReleaseYear,
+				&lastBookID,
+				&lastBookTitle,
+				&lastBookModifiedAt,
+			)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
 			c.JSON(http.StatusInternalServerError, models.APIResponse{
 				Success: false,
 				Message: "Failed to scan category",
@@ -52,6 +174,18 @@ func (h *CategoryHandler) GetAll(c *gin.Context) {
 			})
 			return
 		}
+
+		if withStats {
+			if lastBookID.Valid {
+				stats.LastModifiedBook = &models.CategoryBookSummary{
+					ID:         int(lastBookID.Int64),
+					Title:      lastBookTitle.String,
+					ModifiedAt: lastBookModifiedAt,
+				}
+			}
+			category.Stats = &stats
+		}
+
 		categories = append(categories, category)
 	}
 
@@ -62,27 +196,91 @@ func (h *CategoryHandler) GetAll(c *gin.Context) {
 	})
 }
 
-func (h *CategoryHandler) GetByID(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+// GetTree returns all categories nested below their parents
+func (h *CategoryHandler) GetTree(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, name, slug, parent_id, position, is_visible, created_at, created_by, created_by_user_id, modified_at, modified_by 
+		FROM categories 
+		WHERE organization_id = $1 AND `+h.visibleCondition("id")+`
+		ORDER BY position ASC, id ASC
+	`, currentOrganizationID(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Invalid category ID",
+			Message: "Failed to fetch categories",
 			Error:   err.Error(),
 		})
 		return
 	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var category models.Category
+		err := rows.Scan(
+			&category.ID,
+			&category.Name,
+			&category.Slug,
+			&category.ParentID,
+			&category.Position,
+			&category.IsVisible,
+			&category.CreatedAt,
+			&category.CreatedBy,
+			&category.CreatedByUserID,
+			&category.ModifiedAt,
+			&category.ModifiedBy,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan category",
+				Error:   err.Error(),
+			})
+			return
+		}
+		categories = append(categories, category)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Category tree retrieved successfully",
+		Data:    buildCategoryTree(categories),
+	})
+}
+
+func (h *CategoryHandler) GetByID(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	id, ok := h.resolveCategoryID(c, tx)
+	if !ok {
+		return
+	}
 
 	var category models.Category
-	err = h.DB.QueryRow(`
-		SELECT id, name, created_at, created_by, modified_at, modified_by 
+	err := tx.QueryRow(`
+		SELECT id, name, slug, parent_id, position, is_visible, created_at, created_by, created_by_user_id, modified_at, modified_by 
 		FROM categories 
-		WHERE id = $1
-	`, id).Scan(
+		WHERE id = $1 AND organization_id = $2 AND `+h.visibleCondition("id")+`
+	`, id, currentOrganizationID(c)).Scan(
 		&category.ID,
 		&category.Name,
+		&category.Slug,
+		&category.ParentID,
+		&category.Position,
+		&category.IsVisible,
 		&category.CreatedAt,
 		&category.CreatedBy,
+		&category.CreatedByUserID,
 		&category.ModifiedAt,
 		&category.ModifiedBy,
 	)
@@ -113,7 +311,8 @@ func (h *CategoryHandler) GetByID(c *gin.Context) {
 }
 
 func (h *CategoryHandler) Create(c *gin.Context) {
-	var category models.Category
+	// New categories are visible unless the request says otherwise
+	category := models.Category{IsVisible: true}
 	if err := c.ShouldBindJSON(&category); err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
@@ -123,20 +322,67 @@ func (h *CategoryHandler) Create(c *gin.Context) {
 		return
 	}
 
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   "name must not be blank",
+		})
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	if h.respondIfNameTaken(c, tx, category.Name, 0) {
+		return
+	}
+
+	if !h.validateParent(c, tx, 0, category.ParentID) {
+		return
+	}
+
 	username, exists := c.Get("username")
 	if !exists {
 		username = "system"
 	}
 
-	err := h.DB.QueryRow(`
-		INSERT INTO categories (name, created_by, modified_by) 
-		VALUES ($1, $2, $3) 
-		RETURNING id, created_at, modified_at
-	`, category.Name, username, username).Scan(
+	slug, err := uniqueCategorySlug(tx, currentOrganizationID(c), categorySlugBase(category.Name), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate category slug",
+			Error:   err.Error(),
+		})
+		return
+	}
+	category.Slug = slug
+
+	// New categories are placed after all existing ones of the organization
+	category.CreatedByUserID = ownerOf(c)
+	err = tx.QueryRow(`
+		INSERT INTO categories (name, slug, parent_id, position, is_visible, created_by, created_by_user_id, modified_by, organization_id) 
+		VALUES ($1, $2, $3, (SELECT COALESCE(MAX(position), 0) + 1 FROM categories WHERE organization_id = $8), $4, $5, $6, $7, $8) 
+		RETURNING id, position, created_at, modified_at
+	`, category.Name, category.Slug, category.ParentID, category.IsVisible, username, category.CreatedByUserID, username,
+		currentOrganizationID(c)).Scan(
 		&category.ID,
+		&category.Position,
 		&category.CreatedAt,
 		&category.ModifiedAt,
 	)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if isUniqueViolation(err) {
+		h.respondUniqueViolation(c, category.Name, 0)
+		return
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
@@ -158,30 +404,60 @@ func (h *CategoryHandler) Create(c *gin.Context) {
 	})
 }
 
-func (h *CategoryHandler) Delete(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
+// Update changes a category. PUT replaces all editable fields while PATCH only
+// touches the fields present in the request body. Owners may edit their own
+// categories, users with categories:update every category.
+func (h *CategoryHandler) Update(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	id, ok := h.resolveCategoryID(c, tx)
+	if !ok {
+		return
+	}
+
+	var input models.CategoryUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Invalid category ID",
+			Message: "Invalid request body",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	// Check if category exists
-	var exists bool
-	err = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", id).Scan(&exists)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+	if c.Request.Method == http.MethodPut && input.Name == nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Failed to check category existence",
-			Error:   err.Error(),
+			Message: "Invalid request body",
+			Error:   "name is required",
 		})
 		return
 	}
 
-	if !exists {
+	var category models.Category
+	err := tx.QueryRow(`
+		SELECT id, name, slug, parent_id, position, is_visible, created_at, created_by, created_by_user_id, modified_at, modified_by 
+		FROM categories 
+		WHERE id = $1 AND organization_id = $2
+	`, id, currentOrganizationID(c)).Scan(
+		&category.ID,
+		&category.Name,
+		&category.Slug,
+		&category.ParentID,
+		&category.Position,
+		&category.IsVisible,
+		&category.CreatedAt,
+		&category.CreatedBy,
+		&category.CreatedByUserID,
+		&category.ModifiedAt,
+		&category.ModifiedBy,
+	)
+
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, models.APIResponse{
 			Success: false,
 			Message: "Category not found",
@@ -190,112 +466,703 @@ func (h *CategoryHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	result, err := h.DB.Exec("DELETE FROM categories WHERE id = $1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to delete category",
+			Message: "Failed to fetch category",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.APIResponse{
+	if ownedCategories.respondIfNotAllowed(c, actionUpdate, category.CreatedByUserID) {
+		return
+	}
+
+	previousName := category.Name
+	if input.Name != nil {
+		category.Name = strings.TrimSpace(*input.Name)
+		if category.Name == "" {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request body",
+				Error:   "name must not be blank",
+			})
+			return
+		}
+
+		if h.respondIfNameTaken(c, tx, category.Name, id) {
+			return
+		}
+	}
+
+	// PUT without is_visible makes the category visible
+	if input.IsVisible != nil {
+		category.IsVisible = *input.IsVisible
+	} else if c.Request.Method == http.MethodPut {
+		category.IsVisible = true
+	}
+
+	// PUT without parent_id moves the category to the top level
+	if input.ParentID.Set || c.Request.Method == http.MethodPut {
+		if !h.validateParent(c, tx, id, input.ParentID.Value) {
+			return
+		}
+		category.ParentID = input.ParentID.Value
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	// A rename gets a new slug; the old one is kept so existing links redirect.
+	// Names are compared because a de-duplicated slug differs from its base.
+	oldSlug := category.Slug
+	if categorySlugBase(category.Name) != categorySlugBase(previousName) {
+		category.Slug, err = uniqueCategorySlug(tx, currentOrganizationID(c), categorySlugBase(category.Name), id)
+		if err == nil && category.Slug != oldSlug {
+			err = recordCategorySlugChange(tx, currentOrganizationID(c), id, oldSlug, category.Slug)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to update category slug",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	err = tx.QueryRow(`
+		UPDATE categories
+		SET name = $1, slug = $2, parent_id = $3, is_visible = $4, modified_at = CURRENT_TIMESTAMP, modified_by = $5
+		WHERE id = $6 AND organization_id = $7
+		RETURNING modified_at, modified_by
+	`, category.Name, category.Slug, category.ParentID, category.IsVisible, username, id, currentOrganizationID(c)).Scan(
+		&category.ModifiedAt,
+		&category.ModifiedBy,
+	)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if isUniqueViolation(err) {
+		h.respondUniqueViolation(c, category.Name, id)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Category not found",
-			Error:   "category with specified ID does not exist",
+			Message: "Failed to update category",
+			Error:   err.Error(),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
-		Message: "Category deleted successfully",
+		Message: "Category updated successfully",
+		Data:    category,
 	})
 }
 
-func (h *CategoryHandler) GetBooksByCategory(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
+// Reorder sets the manual order of categories in one statement. The listed
+// categories come first, in the given order, followed by all others in their
+// previous order.
+func (h *CategoryHandler) Reorder(c *gin.Context) {
+	var input models.CategoryOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Invalid category ID",
+			Message: "Invalid request body",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	// Check if category exists
-	var categoryExists bool
-	err = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", id).Scan(&categoryExists)
+	seen := map[int]bool{}
+	for _, id := range input.CategoryIDs {
+		if seen[id] {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid order",
+				Error:   fmt.Sprintf("category %d is listed more than once", id),
+			})
+			return
+		}
+		seen[id] = true
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	var found int
+	err := tx.QueryRow("SELECT COUNT(*) FROM categories WHERE id = ANY($1) AND organization_id = $2",
+		pq.Array(input.CategoryIDs), currentOrganizationID(c)).Scan(&found)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to check category existence",
+			Message: "Failed to validate categories",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	if !categoryExists {
-		c.JSON(http.StatusNotFound, models.APIResponse{
+	if found != len(input.CategoryIDs) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Category not found",
-			Error:   "category with specified ID does not exist",
+			Message: "Invalid order",
+			Error:   "category_ids contains categories that do not exist",
 		})
 		return
 	}
 
-	rows, err := h.DB.Query(`
-		SELECT b.id, b.title, b.description, b.image_url, b.release_year, 
-			   b.price, b.total_page, b.thickness, b.category_id,
-			   b.created_at, b.created_by, b.modified_at, b.modified_by,
-			   c.name as category_name
-		FROM books b
-		LEFT JOIN categories c ON b.category_id = c.id
-		WHERE b.category_id = $1
-		ORDER BY b.id ASC
-	`, id)
-	
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	// Positions are numbered within the organization
+	_, err = tx.Exec(`
+		UPDATE categories
+		SET position = ordered.position, modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (
+				ORDER BY COALESCE(array_position($1::int[], id), 2147483647), position, id
+			) AS position
+			FROM categories
+			WHERE organization_id = $3
+		) ordered
+		WHERE categories.id = ordered.id AND categories.position <> ordered.position
+	`, pq.Array(input.CategoryIDs), username, currentOrganizationID(c))
+	if err == nil {
+		err = tx.Commit()
+	}
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to fetch books",
+			Message: "Failed to reorder categories",
 			Error:   err.Error(),
 		})
 		return
 	}
-	defer rows.Close()
 
-	var books []models.Book
-	for rows.Next() {
-		var book models.Book
-		err := rows.Scan(
-			&book.ID,
-			&book.Title,
-			&book.Description,
-			&book.ImageURL,
-			&book.ReleaseYear,
-			&book.Price,
-			&book.TotalPage,
-			&book.Thickness,
-			&book.CategoryID,
-			&book.CreatedAt,
-			&book.CreatedBy,
-			&book.ModifiedAt,
-			&book.ModifiedBy,
-			&book.CategoryName,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.APIResponse{
-				Success: false,
-				Message: "Failed to scan book",
-				Error:   err.Error(),
-			})
-			return
-		}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Categories reordered successfully",
+	})
+}
+
+// Delete removes a category. The mode query parameter decides what happens to
+// the books in it:
+//   - restrict (default): refuse with 409 while the category has books or
+//     subcategories
+//   - reassign: move the books to target_category_id first
+//   - orphan: leave the books without a category
+//
+// In the other modes the subcategories move up to the deleted category's
+// parent.
+//
+// Owners may delete their own categories, users with categories:delete every
+// category.
+func (h *CategoryHandler) Delete(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	id, ok := h.resolveCategoryID(c, tx)
+	if !ok {
+		return
+	}
+
+	mode := c.DefaultQuery("mode", "restrict")
+	if mode != "restrict" && mode != "reassign" && mode != "orphan" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid delete mode",
+			Error:   "mode must be one of restrict, reassign or orphan",
+		})
+		return
+	}
+
+	var targetID *int
+	if mode == "reassign" {
+		target, err := strconv.Atoi(c.Query("target_category_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid target category ID",
+				Error:   "target_category_id is required when mode is reassign",
+			})
+			return
+		}
+
+		if target == id {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid target category ID",
+				Error:   "target category must differ from the deleted category",
+			})
+			return
+		}
+		targetID = &target
+	}
+
+	// Lock the category so no books are added to it while it is deleted
+	ownerID, err := ownedCategories.owner(c, tx, id)
+	if err != nil {
+		ownedCategories.respondOwnerLookup(c, err)
+		return
+	}
+
+	if ownedCategories.respondIfNotAllowed(c, actionDelete, ownerID) {
+		return
+	}
+
+	var bookCount, subcategoryCount int
+	err = tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM books WHERE category_id = $1),
+			   (SELECT COUNT(*) FROM categories WHERE parent_id = $1)
+	`, id).Scan(&bookCount, &subcategoryCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to count books in category",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result := models.CategoryDeleteResult{
+		Mode:                  mode,
+		AffectedBooks:         bookCount,
+		AffectedSubcategories: subcategoryCount,
+		TargetCategoryID:      targetID,
+	}
+
+	if mode == "restrict" && (bookCount > 0 || subcategoryCount > 0) {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Category still has books or subcategories",
+			Data:    result,
+			Error:   "move the books and subcategories or delete with mode reassign or orphan",
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	if mode == "reassign" {
+		// Lock the target so it cannot disappear before the books are moved
+		err = tx.QueryRow("SELECT id FROM categories WHERE id = $1 AND organization_id = $2 FOR SHARE",
+			*targetID, currentOrganizationID(c)).Scan(targetID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid target category ID",
+				Error:   "target category with specified ID does not exist",
+			})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to validate target category",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		_, err = tx.Exec(`
+			UPDATE books
+			SET category_id = $1, modified_at = CURRENT_TIMESTAMP, modified_by = $2
+			WHERE category_id = $3
+		`, *targetID, username, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to reassign books",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	// Keep the subcategories in place in the tree rather than letting
+	// ON DELETE SET NULL move them to the top level
+	_, err = tx.Exec(`
+		UPDATE categories
+		SET parent_id = (SELECT parent_id FROM categories WHERE id = $1), modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE parent_id = $1
+	`, id, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to move subcategories",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// In orphan mode the books lose their category through ON DELETE SET NULL
+	if _, err := tx.Exec("DELETE FROM categories WHERE id = $1 AND organization_id = $2", id, currentOrganizationID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete category",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete category",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Category deleted successfully",
+		Data:    result,
+	})
+}
+
+// Merge moves all books and subcategories of a category into the target
+// category and then deletes it, recording an audit entry. The ownership policy
+// must allow deleting the merged category and editing the target.
+func (h *CategoryHandler) Merge(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	id, ok := h.resolveCategoryID(c, tx)
+	if !ok {
+		return
+	}
+
+	var input models.CategoryMergeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if input.TargetCategoryID == id {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid target category ID",
+			Error:   "a category cannot be merged into itself",
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	// Lock both categories in ID order to avoid deadlocks with a reverse merge
+	rows, err := tx.Query(`
+		SELECT id, name, slug, created_by_user_id FROM categories WHERE id IN ($1, $2) AND organization_id = $3 ORDER BY id FOR UPDATE
+	`, id, input.TargetCategoryID, currentOrganizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to lock categories",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	names := map[int]string{}
+	slugs := map[int]string{}
+	owners := map[int]*int{}
+	for rows.Next() {
+		var categoryID int
+		var name, slug string
+		var ownerID *int
+		if err := rows.Scan(&categoryID, &name, &slug, &ownerID); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan category",
+				Error:   err.Error(),
+			})
+			return
+		}
+		names[categoryID] = name
+		slugs[categoryID] = slug
+		owners[categoryID] = ownerID
+	}
+	rows.Close()
+
+	if _, ok := names[id]; !ok {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Category not found",
+			Error:   "category with specified ID does not exist",
+		})
+		return
+	}
+
+	if _, ok := names[input.TargetCategoryID]; !ok {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid target category ID",
+			Error:   "target category with specified ID does not exist",
+		})
+		return
+	}
+
+	if ownedCategories.respondIfNotAllowed(c, actionDelete, owners[id]) ||
+		ownedCategories.respondIfNotAllowed(c, actionUpdate, owners[input.TargetCategoryID]) {
+		return
+	}
+
+	// Moving the subcategories below a descendant would create a cycle
+	var targetIsDescendant bool
+	err = tx.QueryRow(categorySubtreeCTE+`SELECT EXISTS(SELECT 1 FROM subtree WHERE id = $2)`, id, input.TargetCategoryID).Scan(&targetIsDescendant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to validate target category",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if targetIsDescendant {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid target category ID",
+			Error:   "a category cannot be merged into one of its subcategories",
+		})
+		return
+	}
+
+	result := models.CategoryMergeResult{
+		SourceCategoryID: id,
+		TargetCategoryID: input.TargetCategoryID,
+	}
+
+	bookResult, err := tx.Exec(`
+		UPDATE books
+		SET category_id = $1, modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE category_id = $3
+	`, input.TargetCategoryID, username, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to move books",
+			Error:   err.Error(),
+		})
+		return
+	}
+	movedBooks, _ := bookResult.RowsAffected()
+	result.MovedBooks = int(movedBooks)
+
+	childResult, err := tx.Exec(`
+		UPDATE categories
+		SET parent_id = $1, modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE parent_id = $3
+	`, input.TargetCategoryID, username, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to move subcategories",
+			Error:   err.Error(),
+		})
+		return
+	}
+	movedSubcategories, _ := childResult.RowsAffected()
+	result.MovedSubcategories = int(movedSubcategories)
+
+	// Links to the merged category keep working by redirecting to the target
+	if err := recordCategorySlugChange(tx, currentOrganizationID(c), input.TargetCategoryID, slugs[id], slugs[input.TargetCategoryID]); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to move category slugs",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE category_slug_history SET category_id = $1 WHERE category_id = $2", input.TargetCategoryID, id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to move category slugs",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM categories WHERE id = $1 AND organization_id = $2", id, currentOrganizationID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete merged category",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	err = recordAudit(tx, "category", id, "merge", gin.H{
+		"source_category_id":   id,
+		"source_category_name": names[id],
+		"target_category_id":   input.TargetCategoryID,
+		"target_category_name": names[input.TargetCategoryID],
+		"moved_books":          result.MovedBooks,
+		"moved_subcategories":  result.MovedSubcategories,
+	}, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to record audit entry",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to merge categories",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Categories merged successfully",
+		Data:    result,
+	})
+}
+
+// TransferOwnership makes another user the owner of a category
+func (h *CategoryHandler) TransferOwnership(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	id, ok := h.resolveCategoryID(c, tx)
+	if !ok {
+		return
+	}
+
+	ownedCategories.transferOwnership(c, tx, id)
+}
+
+func (h *CategoryHandler) GetBooksByCategory(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	id, ok := h.resolveCategoryID(c, tx)
+	if !ok {
+		return
+	}
+
+	// Check if category exists
+	var categoryExists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1 AND organization_id = $2 AND "+h.visibleCondition("id")+")",
+		id, currentOrganizationID(c)).Scan(&categoryExists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to check category existence",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !categoryExists {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Category not found",
+			Error:   "category with specified ID does not exist",
+		})
+		return
+	}
+
+	// Optionally include books of all subcategories
+	categoryFilter := "b.category_id = $1"
+	if c.Query("include_descendants") == "true" {
+		categoryFilter = "b.category_id IN (SELECT id FROM subtree) AND " + h.visibleCondition("b.category_id")
+	}
+
+	rows, err := tx.Query(categorySubtreeCTE+`
+		SELECT b.id, b.title, b.description, b.image_url, b.release_year, 
+			   b.price, b.total_page, b.thickness, b.category_id,
+			   b.created_at, b.created_by, b.created_by_user_id, b.modified_at, b.modified_by,
+			   c.name as category_name
+		FROM books b
+		LEFT JOIN categories c ON b.category_id = c.id
+		WHERE b.organization_id = $2 AND `+categoryFilter+`
+		ORDER BY b.id ASC
+	`, id, currentOrganizationID(c))
+	
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch books",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var book models.Book
+		err := rows.Scan(
+			&book.ID,
+			&book.Title,
+			&book.Description,
+			&book.ImageURL,
+			&book.ReleaseYear,
+			&book.Price,
+			&book.TotalPage,
+			&book.Thickness,
+			&book.CategoryID,
+			&book.CreatedAt,
+			&book.CreatedBy,
+			&book.CreatedByUserID,
+			&book.ModifiedAt,
+			&book.ModifiedBy,
+			&book.CategoryName,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan book",
+				Error:   err.Error(),
+			})
+			return
+		}
 		books = append(books, book)
 	}
 
@@ -304,4 +1171,279 @@ func (h *CategoryHandler) GetBooksByCategory(c *gin.Context) {
 		Message: "Books retrieved successfully",
 		Data:    books,
 	})
-}
\ No newline at end of file
+}
+
+// respondIfNameTaken writes a 409 response carrying the conflicting category
+// when another category of the organization already uses name, compared case-insensitively and
+// ignoring surrounding whitespace. It reports whether a response was written.
+func (h *CategoryHandler) respondIfNameTaken(c *gin.Context, q rowQueryer, name string, excludeID int) bool {
+	var conflict models.Category
+	err := q.QueryRow(`
+		SELECT id, name, slug, parent_id, position, is_visible, created_at, created_by, created_by_user_id, modified_at, modified_by 
+		FROM categories 
+		WHERE LOWER(TRIM(name)) = LOWER(TRIM($1)) AND id <> $2 AND organization_id = $3
+	`, name, excludeID, currentOrganizationID(c)).Scan(
+		&conflict.ID,
+		&conflict.Name,
+		&conflict.Slug,
+		&conflict.ParentID,
+		&conflict.Position,
+		&conflict.IsVisible,
+		&conflict.CreatedAt,
+		&conflict.CreatedBy,
+		&conflict.CreatedByUserID,
+		&conflict.ModifiedAt,
+		&conflict.ModifiedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to check category name",
+			Error:   err.Error(),
+		})
+		return true
+	}
+
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Message: "Category name already exists",
+		Data:    conflict,
+		Error:   "a category with the same name already exists",
+	})
+	return true
+}
+
+// categorySubtreeCTE selects the category $1 and all of its descendants as
+// "subtree". UNION rather than UNION ALL stops the recursion should a cycle
+// ever make it into the table.
+const categorySubtreeCTE = `
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM categories WHERE id = $1
+		UNION
+		SELECT child.id FROM categories child JOIN subtree ON child.parent_id = subtree.id
+	)
+`
+
+// validateParent checks that parentID may become the parent of category id,
+// which is 0 for new categories. A category cannot be moved below itself or
+// one of its descendants. It writes an error response and returns false when
+// the parent is rejected.
+func (h *CategoryHandler) validateParent(c *gin.Context, q rowQueryer, id int, parentID *int) bool {
+	if parentID == nil {
+		return true
+	}
+
+	var parentExists bool
+	err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1 AND organization_id = $2)",
+		*parentID, currentOrganizationID(c)).Scan(&parentExists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to validate parent category",
+			Error:   err.Error(),
+		})
+		return false
+	}
+
+	if !parentExists {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid parent category ID",
+			Error:   "parent category with specified ID does not exist",
+		})
+		return false
+	}
+
+	if id == 0 {
+		return true
+	}
+
+	var createsCycle bool
+	err = q.QueryRow(categorySubtreeCTE+`SELECT EXISTS(SELECT 1 FROM subtree WHERE id = $2)`, id, *parentID).Scan(&createsCycle)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to validate parent category",
+			Error:   err.Error(),
+		})
+		return false
+	}
+
+	if createsCycle {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid parent category ID",
+			Error:   "a category cannot be moved below itself or one of its subcategories",
+		})
+		return false
+	}
+
+	return true
+}
+
+// buildCategoryTree nests a flat list of categories below their parents and
+// returns the top-level categories
+func buildCategoryTree(categories []models.Category) []*models.Category {
+	nodes := make(map[int]*models.Category, len(categories))
+	for i := range categories {
+		nodes[categories[i].ID] = &categories[i]
+	}
+
+	roots := []*models.Category{}
+	for i := range categories {
+		category := &categories[i]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, category)
+				continue
+			}
+		}
+		roots = append(roots, category)
+	}
+	return roots
+}
+
+// respondUniqueViolation answers a unique violation raised while saving a
+// category, which is caused either by its name or by a concurrently claimed
+// slug. The failed transaction is unusable, so it looks in a new one.
+func (h *CategoryHandler) respondUniqueViolation(c *gin.Context, name string, excludeID int) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	if h.respondIfNameTaken(c, tx, name, excludeID) {
+		return
+	}
+
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Message: "Category slug already exists",
+		Error:   "another category claimed the same slug, please retry",
+	})
+}
+
+// resolveCategoryID reads the :id route parameter, which is either a numeric
+// ID or a slug. Old slugs of renamed categories are redirected to the current
+// slug. It writes a response and returns false when the request cannot go on.
+func (h *CategoryHandler) resolveCategoryID(c *gin.Context, q rowQueryer) (int, bool) {
+	param := c.Param("id")
+	if id, err := strconv.Atoi(param); err == nil {
+		return id, true
+	}
+
+	var id int
+	err := q.QueryRow("SELECT id FROM categories WHERE slug = $1 AND organization_id = $2",
+		param, currentOrganizationID(c)).Scan(&id)
+	if err == nil {
+		return id, true
+	}
+
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch category",
+			Error:   err.Error(),
+		})
+		return 0, false
+	}
+
+	var currentSlug string
+	err = q.QueryRow(`
+		SELECT c.slug
+		FROM category_slug_history h
+		JOIN categories c ON h.category_id = c.id
+		WHERE h.slug = $1 AND h.organization_id = $2
+	`, param, currentOrganizationID(c)).Scan(&currentSlug)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Category not found",
+			Error:   "category with specified ID or slug does not exist",
+		})
+		return 0, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch category",
+			Error:   err.Error(),
+		})
+		return 0, false
+	}
+
+	location := strings.Replace(c.FullPath(), ":id", url.PathEscape(currentSlug), 1)
+	if c.Request.URL.RawQuery != "" {
+		location += "?" + c.Request.URL.RawQuery
+	}
+
+	// 308 keeps the method and body for anything that is not a plain read
+	status := http.StatusMovedPermanently
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	c.Redirect(status, location)
+	return 0, false
+}
+
+// categorySlugBase returns the slug derived from a category name. Purely
+// numeric slugs are prefixed so they cannot be mistaken for IDs.
+func categorySlugBase(name string) string {
+	return slug.MakeOr(name, "category")
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// uniqueCategorySlug returns base, or base with the lowest free numeric suffix,
+// skipping slugs used by other categories of organizationID now or in the past
+func uniqueCategorySlug(q queryer, organizationID int, base string, excludeID int) (string, error) {
+	rows, err := q.Query(`
+		SELECT slug FROM categories WHERE (slug = $1 OR slug LIKE $2) AND id <> $3 AND organization_id = $4
+		UNION
+		SELECT slug FROM category_slug_history WHERE (slug = $1 OR slug LIKE $2) AND category_id <> $3 AND organization_id = $4
+	`, base, base+"-%", excludeID, organizationID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	taken := map[string]bool{}
+	for rows.Next() {
+		var existing string
+		if err := rows.Scan(&existing); err != nil {
+			return "", err
+		}
+		taken[existing] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	return slug.Unique(base, taken), nil
+}
+
+// recordCategorySlugChange keeps oldSlug as a redirect to category id of
+// organizationID, which now uses newSlug
+func recordCategorySlugChange(tx *sql.Tx, organizationID, id int, oldSlug, newSlug string) error {
+	_, err := tx.Exec(`
+		INSERT INTO category_slug_history (organization_id, slug, category_id) VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, slug) DO UPDATE SET category_id = EXCLUDED.category_id, created_at = CURRENT_TIMESTAMP
+	`, organizationID, oldSlug, id)
+	if err != nil {
+		return err
+	}
+
+	// A category renamed back to an earlier name takes its old slug again
+	_, err = tx.Exec("DELETE FROM category_slug_history WHERE organization_id = $1 AND slug = $2", organizationID, newSlug)
+	return err
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"book-management-api/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserID returns the ID of the authenticated user as set by the auth
+// middleware. JWT claims are decoded as float64, so both forms are accepted.
+func currentUserID(c *gin.Context) (int, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	}
+	return 0, false
+}
+
+// requireUserID is like currentUserID but writes a 401 response when the
+// request is not tied to a user
+func requireUserID(c *gin.Context) (int, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Authentication required",
+			Error:   "token does not identify a user",
+		})
+		return 0, false
+	}
+	return userID, true
+}
+
+// currentOrganizationID returns the organization the request is scoped to, as
+// set by the auth middleware or, on public routes, by
+// middleware.PublicOrganization. Without either it is 0, which matches no
+// rows.
+func currentOrganizationID(c *gin.Context) int {
+	return c.GetInt("organization_id")
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"book-management-api/models"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// isUniqueViolation reports whether err is a Postgres unique_violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// generateToken returns a random URL-safe token with n bytes of entropy
+func generateToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// beginTenantTx starts a transaction with app.organization_id set to the
+// request's organization. Row-level security limits the API's database role
+// to the rows of that organization, and to none at all outside such a
+// transaction, so every statement on tenant tables must run in one.
+func beginTenantTx(c *gin.Context, db *sql.DB) (*sql.Tx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("SELECT set_config('app.organization_id', $1, true)", strconv.Itoa(currentOrganizationID(c)))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// tenantTx starts a tenant transaction for a handler. It writes a 500
+// response and returns false when the transaction cannot be started.
+func tenantTx(c *gin.Context, db *sql.DB) (*sql.Tx, bool) {
+	tx, err := beginTenantTx(c, db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+	return tx, true
+}
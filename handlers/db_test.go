@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTenantQueriesRunWithOrganizationSetting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, fake := newFakeDB(t)
+	h := NewCategoryHandler(db)
+
+	fake.expect("set_config('app.organization_id'", nil)
+	fake.expect("FROM categories", []string{"id", "name", "slug", "parent_id", "position", "is_visible",
+		"created_at", "created_by", "created_by_user_id", "modified_at", "modified_by"})
+
+	router := gin.New()
+	router.GET("/api/categories/tree", func(c *gin.Context) {
+		c.Set("organization_id", 3)
+		h.GetTree(c)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/categories/tree", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	fake.assertDone()
+
+	settings := fake.calls("set_config")
+	if len(settings) != 1 || settings[0].args[0] != "3" {
+		t.Errorf("app.organization_id set with %v, want 3", settings)
+	}
+}
+
+func TestSharedListIsReadInOwnersOrganization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, fake := newFakeDB(t)
+	adminDB, adminFake := newFakeDB(t)
+	h := NewReadingListHandler(db, adminDB)
+
+	adminFake.expect("SELECT u.organization_id", []string{"organization_id"}, []driver.Value{int64(7)})
+	fake.expect("set_config('app.organization_id'", nil)
+	fake.expect("WHERE share_token = $1", []string{"id", "user_id", "name", "description", "kind", "visibility",
+		"share_token", "created_at", "created_by", "modified_at", "modified_by"},
+		[]driver.Value{int64(1), int64(2), "Summer", nil, "reading", "unlisted", "secret", time.Now(), nil, nil, nil})
+	fake.expect("FROM reading_list_items", []string{"id", "list_id", "book_id", "position", "note",
+		"created_at", "created_by", "modified_at", "modified_by", "book_title"})
+
+	router := gin.New()
+	router.GET("/api/shared/lists/:token", h.GetShared)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/shared/lists/secret", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	fake.assertDone()
+	adminFake.assertDone()
+
+	if settings := fake.calls("set_config"); len(settings) != 1 || settings[0].args[0] != "7" {
+		t.Errorf("app.organization_id set with %v, want 7", settings)
+	}
+}
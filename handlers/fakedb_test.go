@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql driver that answers statements from a script, so
+// handlers can be tested without Postgres. Every expected statement is
+// matched by a substring and answered once; anything else fails.
+type fakeDB struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	expected []*fakeStatement
+	executed []fakeCall
+}
+
+type fakeStatement struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+}
+
+type fakeCall struct {
+	query string
+	args  []driver.Value
+}
+
+func newFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	fake := &fakeDB{t: t}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+// expect answers the next statement containing match with rows of columns.
+// Statements run with Exec need neither.
+func (f *fakeDB) expect(match string, columns []string, rows ...[]driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expected = append(f.expected, &fakeStatement{match: match, columns: columns, rows: rows})
+}
+
+// calls returns the executed statements containing match
+func (f *fakeDB) calls(match string) []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []fakeCall
+	for _, call := range f.executed {
+		if strings.Contains(call.query, match) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// assertDone fails the test when expected statements did not run
+func (f *fakeDB) assertDone() {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, statement := range f.expected {
+		f.t.Errorf("expected statement did not run: %s", statement.match)
+	}
+}
+
+func (f *fakeDB) answer(query string, args []driver.NamedValue) (*fakeStatement, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	f.executed = append(f.executed, fakeCall{query: query, args: values})
+
+	for i, statement := range f.expected {
+		if strings.Contains(query, statement.match) {
+			f.expected = append(f.expected[:i], f.expected[i+1:]...)
+			return statement, nil
+		}
+	}
+	f.t.Errorf("unexpected statement: %s", strings.Join(strings.Fields(query), " "))
+	return nil, errors.New("unexpected statement")
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.db.answer(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	statement, err := c.db.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: statement.columns, rows: statement.rows}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
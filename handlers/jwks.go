@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/models"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	Keys *auth.KeyStore
+}
+
+func NewJWKSHandler(keys *auth.KeyStore) *JWKSHandler {
+	return &JWKSHandler{Keys: keys}
+}
+
+// Get publishes the public keys that verify access tokens as a JWK Set. The
+// body is the bare set, not wrapped in an APIResponse, so standard JWT
+// libraries can consume it.
+func (h *JWKSHandler) Get(c *gin.Context) {
+	set, err := h.Keys.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to load signing keys",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(auth.JWKSMaxAge.Seconds())))
+	c.JSON(http.StatusOK, set)
+}
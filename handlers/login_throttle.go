@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/models"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// throttleKey normalizes a username for login_throttles. It is hashed, as
+// login attempts may send usernames of any length.
+func throttleKey(username string) string {
+	return auth.HashToken(strings.ToLower(strings.TrimSpace(username)))
+}
+
+// loginBlockedFor returns how much longer logins from ip or for username are
+// refused, or zero when they are allowed
+func (h *UserHandler) loginBlockedFor(ip, username string) (time.Duration, error) {
+	var seconds float64
+	err := h.DB.QueryRow(`
+		SELECT COALESCE(MAX(EXTRACT(EPOCH FROM (blocked_until - CURRENT_TIMESTAMP))), 0)
+		FROM login_throttles
+		WHERE ((scope = 'ip' AND key = $1) OR (scope = 'username' AND key = $2))
+		  AND blocked_until > CURRENT_TIMESTAMP
+	`, ip, throttleKey(username)).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// recordLoginFailure counts a failed attempt for ip and username and blocks
+// them according to the configured backoff and lockout thresholds
+func (h *UserHandler) recordLoginFailure(ip, username string) error {
+	settings := h.Cfg.LoginProtection
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Counters of clients that stayed quiet for a whole window are forgotten
+	_, err = tx.Exec(`
+		DELETE FROM login_throttles
+		WHERE last_failure_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+		  AND (blocked_until IS NULL OR blocked_until < CURRENT_TIMESTAMP)
+	`, settings.FailureWindow.Seconds())
+	if err != nil {
+		return err
+	}
+
+	targets := []struct {
+		scope, key                 string
+		backoffAfter, lockoutAfter int
+	}{
+		{"ip", ip, settings.IPBackoffAfter, settings.IPLockoutAfter},
+		{"username", throttleKey(username), settings.UsernameBackoffAfter, settings.UsernameLockoutAfter},
+	}
+
+	for _, target := range targets {
+		var failures int
+		err = tx.QueryRow(`
+			INSERT INTO login_throttles (scope, key, failures, last_failure_at)
+			VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+			ON CONFLICT (scope, key) DO UPDATE
+			SET failures = login_throttles.failures + 1, last_failure_at = CURRENT_TIMESTAMP
+			RETURNING failures
+		`, target.scope, target.key).Scan(&failures)
+		if err != nil {
+			return err
+		}
+
+		delay := auth.LoginBackoff(failures, target.backoffAfter, target.lockoutAfter,
+			settings.BackoffBase, settings.BackoffMax, settings.LockoutDuration)
+		if delay <= 0 {
+			continue
+		}
+
+		_, err = tx.Exec(`
+			UPDATE login_throttles
+			SET blocked_until = CURRENT_TIMESTAMP + make_interval(secs => $3)
+			WHERE scope = $1 AND key = $2
+		`, target.scope, target.key, delay.Seconds())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// clearLoginFailures resets the counter of username after a successful login.
+// The IP counter is left alone so one valid account cannot be used to keep
+// guessing others from the same address.
+func (h *UserHandler) clearLoginFailures(username string) error {
+	_, err := h.DB.Exec("DELETE FROM login_throttles WHERE scope = 'username' AND key = $1", throttleKey(username))
+	return err
+}
+
+// LoginBlockedFor, LoginSucceeded, LoginFailed and LoginRejected apply the
+// login throttling and history to Basic authentication, see
+// middleware.LoginGuard
+func (h *UserHandler) LoginBlockedFor(c *gin.Context, username string) (time.Duration, error) {
+	return h.loginBlockedFor(c.ClientIP(), username)
+}
+
+func (h *UserHandler) LoginSucceeded(c *gin.Context, username string) error {
+	return h.clearLoginFailures(username)
+}
+
+func (h *UserHandler) LoginFailed(c *gin.Context, userID int, username, reason string) error {
+	recordLoginEvent(h.DB, c, userID, username, loginMethodBasic, false, reason, "")
+	return h.recordLoginFailure(c.ClientIP(), username)
+}
+
+func (h *UserHandler) LoginRejected(c *gin.Context, userID int, username, reason string) {
+	recordLoginEvent(h.DB, c, userID, username, loginMethodBasic, false, reason, "")
+}
+
+// checkPasswordThrottled checks password against user's for an action of an
+// authenticated user, such as changing the password or turning off two-factor
+// authentication. Attempts are refused while the login throttle blocks the
+// client or the user, and wrong passwords count as failed logins. It writes
+// an error response and returns false unless the password is correct.
+func (h *UserHandler) checkPasswordThrottled(c *gin.Context, user *models.User, password string) bool {
+	ip := c.ClientIP()
+
+	remaining, err := h.loginBlockedFor(ip, user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return false
+	}
+
+	if remaining > 0 {
+		respondLoginBlocked(c, remaining)
+		return false
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		if err := h.recordLoginFailure(ip, user.Username); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Database error",
+				Error:   err.Error(),
+			})
+			return false
+		}
+
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid current password",
+			Error:   "the current password is not correct",
+		})
+		return false
+	}
+
+	return true
+}
+
+func respondLoginBlocked(c *gin.Context, remaining time.Duration) {
+	seconds := int(math.Ceil(remaining.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, models.APIResponse{
+		Success: false,
+		Message: "Too many login attempts",
+		Error:   "try again in " + strconv.Itoa(seconds) + " seconds",
+	})
+}
+
+// Unlock lifts a login lockout of a user
+func (h *AdminUserHandler) Unlock(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	_, err := h.DB.Exec("DELETE FROM login_throttles WHERE scope = 'username' AND key = $1", throttleKey(user.Username))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to unlock user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "User unlocked successfully",
+		Data:    user,
+	})
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThrottleKeyFitsColumn(t *testing.T) {
+	// login_throttles.key is VARCHAR(255)
+	if key := throttleKey(strings.Repeat("a", 1000)); len(key) > 255 {
+		t.Errorf("key of a long username has %d characters", len(key))
+	}
+	if throttleKey(" Jane.Doe ") != throttleKey("jane.doe") {
+		t.Error("usernames differing in case and spaces get different keys")
+	}
+}
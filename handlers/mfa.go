@@ -0,0 +1,828 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/models"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Number of recovery codes handed out at enrolment
+const recoveryCodeCount = 10
+
+// userTOTP is a row of user_totp. EnabledAt is nil while the enrolment has
+// not been confirmed with a code.
+type userTOTP struct {
+	UserID    int
+	Secret    string
+	EnabledAt *time.Time
+	LastStep  int64
+}
+
+// completeLogin finishes a login after the password (or the OpenID provider)
+// has been checked. Users with two-factor authentication, or whose role
+// requires it, get an MFA challenge token instead of access tokens. method
+// is recorded in the login history.
+func (h *UserHandler) completeLogin(c *gin.Context, user *models.User, method string) {
+	enabled, required, err := mfaState(h.DB, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if enabled || required {
+		token, err := h.createMFAChallenge(c, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to create MFA challenge",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		recordLoginEvent(h.DB, c, user.ID, user.Username, method, false, "mfa_required", "")
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Two-factor authentication required",
+			Data: models.MFAChallengeResponse{
+				MFARequired:        true,
+				MFAToken:           token,
+				ExpiresIn:          int(h.Cfg.MFA.ChallengeTTL.Seconds()),
+				EnrollmentRequired: !enabled,
+			},
+		})
+		return
+	}
+
+	permissions, err := rolePermissions(h.DB, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to load permissions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Generate access and refresh tokens
+	response, _, err := h.issueTokens(h.DB, c, user, permissions, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate token",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	recordLoginEvent(h.DB, c, user.ID, user.Username, method, true, "", response.SessionID)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Login successful",
+		Data:    response,
+	})
+}
+
+// VerifyMFA exchanges an MFA challenge token and a TOTP or recovery code for
+// access tokens. A code for a TOTP secret from EnrollMFA also confirms the
+// enrolment; the response then carries the new recovery codes.
+func (h *UserHandler) VerifyMFA(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   "exactly one of code or recovery_code is required",
+		})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	challengeID, user, ok := h.lockMFAChallenge(c, tx, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	if respondIfInactive(c, user) {
+		recordLoginEvent(h.DB, c, user.ID, user.Username, loginMethodMFA, false, "account_"+user.Status, "")
+		return
+	}
+
+	totp, err := lockTOTP(tx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if totp == nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Enrollment required",
+			Error:   "set up an authenticator with /api/users/mfa/enroll first",
+		})
+		return
+	}
+
+	var (
+		valid         bool
+		recoveryCodes []string
+	)
+	if req.RecoveryCode != "" {
+		valid, err = useRecoveryCode(tx, user.ID, req.RecoveryCode)
+	} else {
+		valid, err = acceptTOTPCode(tx, totp, req.Code)
+		if err == nil && valid && totp.EnabledAt == nil {
+			recoveryCodes, err = enableTOTP(tx, user.ID)
+		}
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to verify code",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !valid {
+		// Count the attempt against the challenge and the login throttle
+		_, err = tx.Exec("UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1", challengeID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err == nil {
+			err = h.recordLoginFailure(c.ClientIP(), user.Username)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Database error",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		recordLoginEvent(h.DB, c, user.ID, user.Username, loginMethodMFA, false, "invalid_mfa_code", "")
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid code",
+			Error:   "the code is not valid",
+		})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM mfa_challenges WHERE id = $1", challengeID)
+
+	var permissions []string
+	if err == nil {
+		permissions, err = rolePermissions(tx, user.Role)
+	}
+
+	var response *models.LoginResponse
+	if err == nil {
+		response, _, err = h.issueTokens(tx, c, user, permissions, "")
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate token",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	recordLoginEvent(h.DB, c, user.ID, user.Username, loginMethodMFA, true, "", response.SessionID)
+	response.RecoveryCodes = recoveryCodes
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Login successful",
+		Data:    response,
+	})
+}
+
+// EnrollMFA starts a TOTP enrolment during login, for users whose role
+// requires two-factor authentication but who have not set it up. The code
+// from the authenticator then goes to VerifyMFA with the same token.
+func (h *UserHandler) EnrollMFA(c *gin.Context) {
+	var req models.MFAEnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	_, user, ok := h.lockMFAChallenge(c, tx, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	h.startTOTPEnrollment(c, tx, user)
+}
+
+// GetMFAStatus reports whether the authenticated user has two-factor
+// authentication enabled and how many recovery codes are left
+func (h *UserHandler) GetMFAStatus(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var status models.MFAStatus
+	err := h.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = u.id AND enabled_at IS NOT NULL),
+			   r.require_mfa,
+			   (SELECT COUNT(*) FROM recovery_codes WHERE user_id = u.id AND used_at IS NULL)
+		FROM users u
+		JOIN roles r ON r.name = u.role
+		WHERE u.id = $1
+	`, userID).Scan(&status.Enabled, &status.Required, &status.RecoveryCodesRemaining)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch two-factor status",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Two-factor status retrieved successfully",
+		Data:    status,
+	})
+}
+
+// EnrollTOTP creates a new TOTP secret for the authenticated user. It only
+// takes effect once ConfirmTOTP has seen a code for it.
+func (h *UserHandler) EnrollTOTP(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var user models.User
+	err = scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	h.startTOTPEnrollment(c, tx, &user)
+}
+
+// ConfirmTOTP enables the secret from EnrollTOTP after checking a code from
+// the authenticator, and returns the recovery codes. They are shown only once.
+func (h *UserHandler) ConfirmTOTP(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	totp, err := lockTOTP(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if totp == nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "No enrollment in progress",
+			Error:   "start the enrollment with POST /api/users/me/mfa/totp first",
+		})
+		return
+	}
+
+	if totp.EnabledAt != nil {
+		respondMFAAlreadyEnabled(c)
+		return
+	}
+
+	valid, err := acceptTOTPCode(tx, totp, req.Code)
+	var recoveryCodes []string
+	if err == nil && valid {
+		recoveryCodes, err = enableTOTP(tx, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to enable two-factor authentication",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !valid {
+		respondInvalidTOTPCode(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Two-factor authentication enabled",
+		Data:    models.RecoveryCodesResponse{RecoveryCodes: recoveryCodes},
+	})
+}
+
+// DisableTOTP turns two-factor authentication off after checking the
+// password, which is throttled like a login. Users whose role requires it
+// cannot turn it off.
+func (h *UserHandler) DisableTOTP(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.DisableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	err := scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !h.checkPasswordThrottled(c, &user, req.Password) {
+		return
+	}
+
+	_, required, err := mfaState(h.DB, &user)
+	if err == nil && required {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Two-factor authentication required",
+			Error:   "the role '" + user.Role + "' requires two-factor authentication",
+		})
+		return
+	}
+
+	if err == nil {
+		err = removeMFA(h.DB, user.ID)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to disable two-factor authentication",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the authenticated
+// user after checking a TOTP code
+func (h *UserHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	totp, err := lockTOTP(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if totp == nil || totp.EnabledAt == nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Two-factor authentication not enabled",
+			Error:   "recovery codes are only available with two-factor authentication enabled",
+		})
+		return
+	}
+
+	valid, err := acceptTOTPCode(tx, totp, req.Code)
+	var recoveryCodes []string
+	if err == nil && valid {
+		recoveryCodes, err = replaceRecoveryCodes(tx, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate recovery codes",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !valid {
+		respondInvalidTOTPCode(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Recovery codes generated",
+		Data:    models.RecoveryCodesResponse{RecoveryCodes: recoveryCodes},
+	})
+}
+
+// ResetMFA removes the two-factor setup of a user who lost their
+// authenticator and recovery codes. Users whose role requires two-factor
+// authentication have to enrol again at their next login.
+func (h *AdminUserHandler) ResetMFA(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok || respondIfRoleReserved(c, h.DB, user.Role) {
+		return
+	}
+
+	if err := removeMFA(h.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reset two-factor authentication",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Two-factor authentication reset successfully",
+		Data:    user,
+	})
+}
+
+// startTOTPEnrollment replaces any unconfirmed secret of user with a new one
+// and writes it to the response, committing tx
+func (h *UserHandler) startTOTPEnrollment(c *gin.Context, tx *sql.Tx, user *models.User) {
+	totp, err := lockTOTP(tx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if totp != nil && totp.EnabledAt != nil {
+		respondMFAAlreadyEnabled(c)
+		return
+	}
+
+	var enrollment models.TOTPEnrollment
+	secret, err := auth.GenerateTOTPSecret()
+	if err == nil {
+		enrollment.Secret = secret
+		enrollment.OTPAuthURI = auth.TOTPURI(h.Cfg.MFA.Issuer, user.Username, secret)
+		enrollment.QRCode, err = auth.TOTPQRCode(enrollment.OTPAuthURI)
+	}
+	if err == nil {
+		_, err = tx.Exec(`
+			INSERT INTO user_totp (user_id, secret)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		`, user.ID, secret)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start enrollment",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Add the secret to an authenticator app and confirm with a code",
+		Data:    enrollment,
+	})
+}
+
+// createMFAChallenge stores a new challenge for user and returns its token
+func (h *UserHandler) createMFAChallenge(c *gin.Context, user *models.User) (string, error) {
+	token, err := generateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	_, err = h.DB.Exec("DELETE FROM mfa_challenges WHERE user_id = $1 AND expires_at < $2", user.ID, now)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = h.DB.Exec(`
+		INSERT INTO mfa_challenges (user_id, token_hash, expires_at, ip_address)
+		VALUES ($1, $2, $3, $4)
+	`, user.ID, auth.HashToken(token), now.Add(h.Cfg.MFA.ChallengeTTL), c.ClientIP())
+	return token, err
+}
+
+// lockMFAChallenge locks the challenge with token and loads its user. It
+// writes a 401 response for unknown, expired or used up challenges and
+// reports whether the challenge is valid.
+func (h *UserHandler) lockMFAChallenge(c *gin.Context, tx *sql.Tx, token string) (int, *models.User, bool) {
+	var (
+		challengeID, userID, attempts int
+		expiresAt                     time.Time
+	)
+	err := tx.QueryRow(`
+		SELECT id, user_id, expires_at, attempts
+		FROM mfa_challenges
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, auth.HashToken(token)).Scan(&challengeID, &userID, &expiresAt, &attempts)
+
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch MFA challenge",
+			Error:   err.Error(),
+		})
+		return 0, nil, false
+	}
+
+	if err == sql.ErrNoRows || time.Now().After(expiresAt) || attempts >= h.Cfg.MFA.MaxAttempts {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid MFA token",
+			Error:   "the MFA token is invalid, expired or has too many failed attempts, log in again",
+		})
+		return 0, nil, false
+	}
+
+	var user models.User
+	err = scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch user",
+			Error:   err.Error(),
+		})
+		return 0, nil, false
+	}
+
+	return challengeID, &user, true
+}
+
+// mfaState reports whether user has two-factor authentication enabled and
+// whether the user's role requires it
+func mfaState(db *sql.DB, user *models.User) (enabled, required bool, err error) {
+	err = db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL),
+			   COALESCE((SELECT require_mfa FROM roles WHERE name = $2), FALSE)
+	`, user.ID, user.Role).Scan(&enabled, &required)
+	return enabled, required, err
+}
+
+// lockTOTP locks and returns the TOTP row of userID, or nil if there is none
+func lockTOTP(tx *sql.Tx, userID int) (*userTOTP, error) {
+	totp := userTOTP{UserID: userID}
+	err := tx.QueryRow(`
+		SELECT secret, enabled_at, last_step FROM user_totp
+		WHERE user_id = $1
+		FOR UPDATE
+	`, userID).Scan(&totp.Secret, &totp.EnabledAt, &totp.LastStep)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+// acceptTOTPCode checks code and remembers its time step, so the same code
+// is not accepted again
+func acceptTOTPCode(tx *sql.Tx, totp *userTOTP, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now(), totp.LastStep)
+	if !ok {
+		return false, nil
+	}
+
+	_, err := tx.Exec("UPDATE user_totp SET last_step = $1 WHERE user_id = $2", step, totp.UserID)
+	return err == nil, err
+}
+
+// enableTOTP confirms the enrolment of userID and returns new recovery codes
+func enableTOTP(tx *sql.Tx, userID int) ([]string, error) {
+	_, err := tx.Exec("UPDATE user_totp SET enabled_at = $1 WHERE user_id = $2", time.Now().UTC(), userID)
+	if err != nil {
+		return nil, err
+	}
+	return replaceRecoveryCodes(tx, userID)
+}
+
+// replaceRecoveryCodes deletes the recovery codes of userID and returns new
+// ones. Only their hashes are stored.
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		code, err := auth.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO recovery_codes (user_id, code_hash)
+			VALUES ($1, $2)
+		`, userID, auth.HashToken(auth.NormalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// useRecoveryCode marks code as used and reports whether it was a valid,
+// unused recovery code of userID
+func useRecoveryCode(tx *sql.Tx, userID int, code string) (bool, error) {
+	result, err := tx.Exec(`
+		UPDATE recovery_codes SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL
+	`, time.Now().UTC(), userID, auth.HashToken(auth.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// removeMFA deletes the TOTP secret, recovery codes and open challenges of
+// userID
+func removeMFA(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"user_totp", "recovery_codes", "mfa_challenges"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = $1", userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func respondMFAAlreadyEnabled(c *gin.Context) {
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Message: "Two-factor authentication already enabled",
+		Error:   "disable two-factor authentication before enrolling a new authenticator",
+	})
+}
+
+func respondInvalidTOTPCode(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, models.APIResponse{
+		Success: false,
+		Message: "Invalid code",
+		Error:   "the code is not valid",
+	})
+}
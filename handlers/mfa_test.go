@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"book-management-api/config"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDisableTOTPCountsWrongPasswords(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, fake := newFakeDB(t)
+	h := NewUserHandler(db, &config.Config{}, nil, nil, nil)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("Correct-Horse-42"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.expect("FROM users WHERE id = $1", strings.Split(strings.ReplaceAll(userColumns, " ", ""), ","),
+		[]driver.Value{int64(5), "jane.doe", nil, string(hash), "user", "active", false, int64(0), int64(1),
+			time.Now(), nil, nil, nil})
+	fake.expect("MAX(EXTRACT(EPOCH", []string{"seconds"}, []driver.Value{float64(0)})
+	fake.expect("DELETE FROM login_throttles", nil)
+	fake.expect("INSERT INTO login_throttles", []string{"failures"}, []driver.Value{int64(1)})
+	fake.expect("INSERT INTO login_throttles", []string{"failures"}, []driver.Value{int64(1)})
+
+	router := gin.New()
+	router.DELETE("/api/users/me/mfa/totp", func(c *gin.Context) {
+		c.Set("user_id", 5)
+		h.DisableTOTP(c)
+	})
+
+	body := `{"password": "wrong"}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/users/me/mfa/totp", strings.NewReader(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+	}
+	fake.assertDone()
+
+	failures := fake.calls("INSERT INTO login_throttles")
+	if len(failures) != 2 || failures[1].args[1] != throttleKey("jane.doe") {
+		t.Errorf("failures recorded as %v, want for the IP and jane.doe", failures)
+	}
+}
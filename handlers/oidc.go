@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/config"
+	"book-management-api/models"
+	"book-management-api/oidc"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// How long a user may take at the identity provider before the callback
+const oidcStateTTL = 10 * time.Minute
+
+// Cookie holding the hash of the login state. The callback must come from the
+// browser that started the login, so a victim cannot be logged in to the
+// attacker's account with a forged callback URL.
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/users/oidc"
+)
+
+var errNoLinkedAccount = errors.New("no local account is linked to this identity")
+
+// Characters not allowed in usernames, replaced when deriving one from claims
+var invalidUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// OIDCHandler logs users in through an OpenID provider and then issues the
+// same tokens as a password login
+type OIDCHandler struct {
+	DB       *sql.DB
+	Cfg      *config.Config
+	Provider *oidc.Provider
+	Users    *UserHandler
+}
+
+func NewOIDCHandler(db *sql.DB, cfg *config.Config, provider *oidc.Provider, users *UserHandler) *OIDCHandler {
+	return &OIDCHandler{
+		DB:       db,
+		Cfg:      cfg,
+		Provider: provider,
+		Users:    users,
+	}
+}
+
+// Login starts the authorization code flow with PKCE by redirecting to the
+// provider. With ?redirect=false the provider URL is returned as JSON instead.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	var values [3]string
+	for i := range values {
+		value, err := generateToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to start login",
+				Error:   err.Error(),
+			})
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	authURL, err := h.Provider.AuthCodeURL(c.Request.Context(), state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, models.APIResponse{
+			Success: false,
+			Message: "Identity provider unavailable",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	_, err = h.DB.Exec("DELETE FROM oidc_login_states WHERE expires_at < $1", time.Now().UTC())
+	if err == nil {
+		_, err = h.DB.Exec(`
+			INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at)
+			VALUES ($1, $2, $3, $4)
+		`, auth.HashToken(state), nonce, codeVerifier, time.Now().Add(oidcStateTTL).UTC())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start login",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	h.setStateCookie(c, auth.HashToken(state), int(oidcStateTTL.Seconds()))
+
+	if c.Query("redirect") == "false" {
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Continue the login at the identity provider",
+			Data:    gin.H{"authorization_url": authURL},
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback finishes the login: it redeems the code, validates the ID token,
+// finds or creates the local user and completes the login like a password login
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Login at the identity provider failed",
+			Error:   strings.TrimSpace(providerError + " " + c.Query("error_description")),
+		})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid callback",
+			Error:   "state and code are required",
+		})
+		return
+	}
+
+	cookie, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(auth.HashToken(state))) != 1 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid callback",
+			Error:   "the login was not started in this browser, please start the login again",
+		})
+		return
+	}
+
+	// A state can only be used once
+	var (
+		nonce, codeVerifier string
+		expiresAt           time.Time
+	)
+	err := h.DB.QueryRow(`
+		DELETE FROM oidc_login_states WHERE state_hash = $1
+		RETURNING nonce, code_verifier, expires_at
+	`, auth.HashToken(state)).Scan(&nonce, &codeVerifier, &expiresAt)
+
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err == sql.ErrNoRows || time.Now().After(expiresAt) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid callback",
+			Error:   "login state is unknown or expired, please start the login again",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rawIDToken, err := h.Provider.Exchange(ctx, code, codeVerifier)
+	var claims jwt.MapClaims
+	if err == nil {
+		claims, err = h.Provider.VerifyIDToken(ctx, rawIDToken, nonce)
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Login at the identity provider failed",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	user, err := h.findOrProvisionUser(claims)
+	if err == errNoLinkedAccount {
+		recordLoginEvent(h.DB, c, 0, claimString(claims, h.Cfg.OIDC.UsernameClaim), loginMethodOIDC, false, "no_account", "")
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "No account",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to load user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if respondIfInactive(c, user) {
+		recordLoginEvent(h.DB, c, user.ID, user.Username, loginMethodOIDC, false, "account_"+user.Status, "")
+		return
+	}
+
+	h.Users.completeLogin(c, user, loginMethodOIDC)
+}
+
+// setStateCookie sets the login state cookie to value for maxAge seconds, or
+// removes it with a negative maxAge
+func (h *OIDCHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcStateCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.Cfg.Environment == "production" || c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// findOrProvisionUser returns the user linked to the token's issuer and
+// subject. Unknown identities get a new account when auto-provisioning is on.
+// With a role claim configured the role is updated on every login, except for
+// users holding a reserved role, which are only managed locally.
+func (h *OIDCHandler) findOrProvisionUser(claims jwt.MapClaims) (*models.User, error) {
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	role, err := h.roleFromClaims(tx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = scanUser(tx.QueryRow(`
+		SELECT `+prefixColumns("u", userColumns)+`
+		FROM users u
+		JOIN user_identities i ON i.user_id = u.id
+		WHERE i.issuer = $1 AND i.subject = $2
+	`, issuer, subject), &user)
+
+	switch {
+	case err == nil:
+		_, err = tx.Exec("UPDATE user_identities SET last_login_at = CURRENT_TIMESTAMP WHERE issuer = $1 AND subject = $2", issuer, subject)
+		if err == nil && h.Cfg.OIDC.RoleClaim != "" && role != user.Role {
+			var reserved bool
+			reserved, err = isRoleReservedForClaims(tx, user.Role)
+			if err == nil && !reserved {
+				err = scanUser(tx.QueryRow(`
+					UPDATE users
+					SET role = $1, token_version = token_version + 1, modified_at = CURRENT_TIMESTAMP, modified_by = 'oidc'
+					WHERE id = $2
+					RETURNING `+userColumns,
+					role, user.ID), &user)
+			}
+		}
+
+	case err == sql.ErrNoRows:
+		if !h.Cfg.OIDC.AutoProvision {
+			return nil, errNoLinkedAccount
+		}
+		err = h.provisionUser(tx, claims, issuer, subject, role, &user)
+	}
+
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// provisionUser creates a local account for a new identity in the default
+// organization. The account gets a random password, so it can only log in
+// through the provider.
+func (h *OIDCHandler) provisionUser(tx *sql.Tx, claims jwt.MapClaims, issuer, subject, role string, user *models.User) error {
+	email := normalizeEmail(claimString(claims, h.Cfg.OIDC.EmailClaim))
+	if email != nil {
+		var taken bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))", *email).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			email = nil
+		}
+	}
+
+	username, err := h.uniqueUsername(tx, claims)
+	if err != nil {
+		return err
+	}
+
+	secret, err := generateToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	organizationID, err := organizationIDBySlug(tx, h.Cfg.Tenancy.DefaultOrganization)
+	if err != nil {
+		return err
+	}
+
+	status := "active"
+	if h.Cfg.Registration.RequireApproval {
+		status = "pending"
+	}
+
+	err = scanUser(tx.QueryRow(`
+		INSERT INTO users (username, email, password, role, status, organization_id, created_by, modified_by)
+		VALUES ($1, $2, $3, $4, $5, $6, 'oidc', 'oidc')
+		RETURNING `+userColumns,
+		username, email, string(hashedPassword), role, status, organizationID), user)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, last_login_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+	`, user.ID, issuer, subject)
+	return err
+}
+
+// uniqueUsername derives a free username from the username claim, falling
+// back to the local part of the email address. Taken names get a numeric
+// suffix.
+func (h *OIDCHandler) uniqueUsername(tx *sql.Tx, claims jwt.MapClaims) (string, error) {
+	base := claimString(claims, h.Cfg.OIDC.UsernameClaim)
+	if base == "" {
+		base, _, _ = strings.Cut(claimString(claims, h.Cfg.OIDC.EmailClaim), "@")
+	}
+
+	base = strings.TrimLeft(invalidUsernameChars.ReplaceAllString(base, "-"), "._-")
+	if base == "" {
+		base = "user"
+	}
+
+	maxLength := h.Cfg.Registration.UsernameMaxLength
+	for i := 1; i <= 1000; i++ {
+		suffix := ""
+		if i > 1 {
+			suffix = "-" + strconv.Itoa(i)
+		}
+
+		// Keeps at least one character of base, even if that exceeds maxLength
+		candidate := truncateRunes(base, max(maxLength-len(suffix), 1)) + suffix
+
+		var taken bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))", candidate).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+
+	return "", errors.New("could not find a free username for " + base)
+}
+
+// roleFromClaims maps the values of the role claim through OIDC_ROLE_MAPPING
+// and returns the first mapped role that exists and is not reserved, or the
+// default role. Values without a mapping are ignored.
+func (h *OIDCHandler) roleFromClaims(tx *sql.Tx, claims jwt.MapClaims) (string, error) {
+	if h.Cfg.OIDC.RoleClaim == "" {
+		return h.Cfg.OIDC.DefaultRole, nil
+	}
+
+	var candidates []string
+	switch value := claims[h.Cfg.OIDC.RoleClaim].(type) {
+	case string:
+		candidates = strings.Fields(value)
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				candidates = append(candidates, s)
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		role, ok := h.Cfg.OIDC.RoleMapping[candidate]
+		if !ok {
+			continue
+		}
+
+		reserved, err := isRoleReservedForClaims(tx, role)
+		if err != nil {
+			return "", err
+		}
+		if reserved {
+			continue
+		}
+
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", role).Scan(&exists); err != nil {
+			return "", err
+		}
+		if exists {
+			return role, nil
+		}
+	}
+	return h.Cfg.OIDC.DefaultRole, nil
+}
+
+// isRoleReservedForClaims reports whether role may never be granted from ID
+// token claims: the admin roles and every role that can manage users or
+// organizations
+func isRoleReservedForClaims(q rowQueryer, role string) (bool, error) {
+	if role == "admin" || role == "super_admin" {
+		return true, nil
+	}
+
+	var reserved bool
+	err := q.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM role_permissions WHERE role_name = $1 AND permission_name IN ('users:manage', 'organizations:manage'))
+	`, role).Scan(&reserved)
+	return reserved, err
+}
+
+// truncateRunes shortens s to at most n bytes without splitting a character
+func truncateRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func claimString(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return strings.TrimSpace(value)
+}
+
+// prefixColumns qualifies every column of a comma separated list with alias
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, part := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ", ")
+}
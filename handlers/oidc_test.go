@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"book-management-api/config"
+	"book-management-api/oidc"
+	"book-management-api/oidc/oidctest"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var userTestColumns = []string{"id", "username", "email", "password", "role", "status", "must_change_password",
+	"token_version", "organization_id", "created_at", "created_by", "modified_at", "modified_by"}
+
+type oidcTest struct {
+	t      *testing.T
+	idp    *oidctest.Provider
+	cfg    *config.Config
+	db     *sql.DB
+	fake   *fakeDB
+	router *gin.Engine
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	gin.SetMode(gin.TestMode)
+
+	idp := oidctest.NewProvider("book-api")
+	t.Cleanup(idp.Close)
+
+	cfg := &config.Config{}
+	cfg.OIDC.IssuerURL = idp.Issuer()
+	cfg.OIDC.ClientID = "book-api"
+	cfg.OIDC.RedirectURL = "http://localhost:8080/api/users/oidc/callback"
+	cfg.OIDC.Scopes = []string{"openid", "profile", "email"}
+	cfg.OIDC.UsernameClaim = "preferred_username"
+	cfg.OIDC.EmailClaim = "email"
+	cfg.OIDC.DefaultRole = "reader"
+	cfg.Registration.UsernameMaxLength = 50
+	cfg.Tenancy.DefaultOrganization = "default"
+
+	db, fake := newFakeDB(t)
+	provider := oidc.NewProvider(oidc.Config{
+		IssuerURL:   cfg.OIDC.IssuerURL,
+		ClientID:    cfg.OIDC.ClientID,
+		RedirectURL: cfg.OIDC.RedirectURL,
+		Scopes:      cfg.OIDC.Scopes,
+	}, nil)
+	h := NewOIDCHandler(db, cfg, provider, &UserHandler{DB: db, Cfg: cfg})
+
+	router := gin.New()
+	router.GET("/api/users/oidc/login", h.Login)
+	router.GET("/api/users/oidc/callback", h.Callback)
+
+	return &oidcTest{t: t, idp: idp, cfg: cfg, db: db, fake: fake, router: router}
+}
+
+// login starts a login and lets the user sign in at the provider. It returns
+// the callback request the browser would send, with the state cookie.
+func (o *oidcTest) login() *http.Request {
+	o.t.Helper()
+
+	o.fake.expect("DELETE FROM oidc_login_states WHERE expires_at", nil)
+	o.fake.expect("INSERT INTO oidc_login_states", nil)
+
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/oidc/login?redirect=false", nil))
+	if w.Code != http.StatusOK {
+		o.t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+
+	var body struct {
+		Data struct {
+			AuthorizationURL string `json:"authorization_url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		o.t.Fatalf("login: %v", err)
+	}
+
+	code, state, err := o.idp.Authorize(body.Data.AuthorizationURL)
+	if err != nil {
+		o.t.Fatalf("authorize: %v", err)
+	}
+
+	// The stored state is handed back by the callback
+	stored := o.fake.calls("INSERT INTO oidc_login_states")[0].args
+	o.fake.expect("DELETE FROM oidc_login_states WHERE state_hash", []string{"nonce", "code_verifier", "expires_at"},
+		[]driver.Value{stored[1], stored[2], time.Now().Add(time.Minute)})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/oidc/callback?state="+state+"&code="+code, nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func (o *oidcTest) callback(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCLoginSetsStateCookie(t *testing.T) {
+	o := newOIDCTest(t)
+	o.fake.expect("DELETE FROM oidc_login_states WHERE expires_at", nil)
+	o.fake.expect("INSERT INTO oidc_login_states", nil)
+
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusFound)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+		t.Fatalf("cookies = %v, want %s", cookies, oidcStateCookie)
+	}
+	cookie := cookies[0]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+		t.Errorf("cookie = %+v, want HttpOnly, SameSite=Lax and a max age", cookie)
+	}
+	if stateHash := o.fake.calls("INSERT INTO oidc_login_states")[0].args[0]; cookie.Value != stateHash {
+		t.Errorf("cookie holds %q, want the state hash %q", cookie.Value, stateHash)
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	o := newOIDCTest(t)
+	req := o.login()
+
+	// A forged callback carries the attacker's state but not their cookie
+	forged := httptest.NewRequest(http.MethodGet, req.URL.String(), nil)
+	if w := o.callback(forged); w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+	if calls := o.fake.calls("WHERE state_hash"); len(calls) != 0 {
+		t.Error("login state was consumed by a callback without the state cookie")
+	}
+}
+
+func TestOIDCCallbackWithoutAccount(t *testing.T) {
+	o := newOIDCTest(t)
+	o.cfg.OIDC.AutoProvision = false
+	req := o.login()
+
+	o.fake.expect("JOIN user_identities", userTestColumns)
+	o.fake.expect("INSERT INTO login_events", nil)
+
+	w := o.callback(req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	o.fake.assertDone()
+
+	event := o.fake.calls("INSERT INTO login_events")[0].args
+	if event[1] != "" || event[4] != "no_account" {
+		t.Errorf("login event = %v, want failure no_account", event)
+	}
+	if calls := o.fake.calls("INSERT INTO users"); len(calls) != 0 {
+		t.Error("a user was created with auto-provisioning off")
+	}
+}
+
+func TestOIDCCallbackProvisionsUser(t *testing.T) {
+	o := newOIDCTest(t)
+	o.cfg.OIDC.AutoProvision = true
+	o.cfg.OIDC.RoleClaim = "groups"
+	o.cfg.OIDC.RoleMapping = map[string]string{"admins": "admin", "staff": "librarian"}
+	// Pending accounts stop before tokens are issued
+	o.cfg.Registration.RequireApproval = true
+	o.idp.Claims["preferred_username"] = "jane.doe"
+	o.idp.Claims["email"] = "Jane@Example.com"
+	o.idp.Claims["groups"] = []string{"unmapped", "admins", "staff"}
+	req := o.login()
+
+	o.fake.expect("FROM role_permissions", []string{"exists"}, []driver.Value{false})
+	o.fake.expect("FROM roles WHERE name", []string{"exists"}, []driver.Value{true})
+	o.fake.expect("JOIN user_identities", userTestColumns)
+	o.fake.expect("LOWER(email)", []string{"exists"}, []driver.Value{false})
+	o.fake.expect("LOWER(username)", []string{"exists"}, []driver.Value{false})
+	o.fake.expect("FROM organizations WHERE slug", []string{"id"}, []driver.Value{int64(1)})
+	o.fake.expect("INSERT INTO users", userTestColumns, []driver.Value{
+		int64(7), "jane.doe", "Jane@Example.com", "hash", "librarian", "pending", false, int64(0), int64(1),
+		time.Now(), "oidc", time.Now(), "oidc",
+	})
+	o.fake.expect("INSERT INTO user_identities", nil)
+	o.fake.expect("INSERT INTO login_events", nil)
+
+	w := o.callback(req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	o.fake.assertDone()
+
+	// admin is mapped but never granted from claims
+	if roles := o.fake.calls("FROM roles WHERE name"); len(roles) != 1 || roles[0].args[0] != "librarian" {
+		t.Errorf("role lookups = %v, want only librarian", roles)
+	}
+	if user := o.fake.calls("INSERT INTO users")[0].args; user[3] != "librarian" {
+		t.Errorf("role = %v, want librarian", user[3])
+	}
+
+	user := o.fake.calls("INSERT INTO users")[0].args
+	if user[0] != "jane.doe" || user[1] != "Jane@Example.com" || user[4] != "pending" || user[5] != int64(1) {
+		t.Errorf("created user = %v", user)
+	}
+
+	identity := o.fake.calls("INSERT INTO user_identities")[0].args
+	if identity[0] != int64(7) || identity[1] != o.idp.Issuer() || identity[2] != "subject-1" {
+		t.Errorf("linked identity = %v", identity)
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidIDToken(t *testing.T) {
+	o := newOIDCTest(t)
+	o.idp.Claims["aud"] = "another-client"
+	req := o.login()
+
+	if w := o.callback(req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+	}
+	o.fake.assertDone()
+}
+
+func TestRoleFromClaimsSkipsReservedRoles(t *testing.T) {
+	o := newOIDCTest(t)
+	o.cfg.OIDC.RoleClaim = "groups"
+	o.cfg.OIDC.RoleMapping = map[string]string{"it": "user-manager", "root": "super_admin"}
+	h := &OIDCHandler{Cfg: o.cfg}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	o.fake.expect("FROM role_permissions", []string{"exists"}, []driver.Value{true})
+
+	role, err := h.roleFromClaims(tx, jwt.MapClaims{"groups": []interface{}{"root", "it", "admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "reader" {
+		t.Errorf("role = %q, want the default role", role)
+	}
+	o.fake.assertDone()
+}
+
+func TestUniqueUsernameTruncates(t *testing.T) {
+	o := newOIDCTest(t)
+	o.cfg.Registration.UsernameMaxLength = 1
+	h := &OIDCHandler{Cfg: o.cfg}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	o.fake.expect("LOWER(username)", []string{"exists"}, []driver.Value{true})
+	o.fake.expect("LOWER(username)", []string{"exists"}, []driver.Value{false})
+
+	username, err := h.uniqueUsername(tx, jwt.MapClaims{"preferred_username": "jane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The suffix does not fit, but the name keeps its first character
+	if username != "j-2" {
+		t.Errorf("username = %q", username)
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"jane", 10, "jane"},
+		{"jane", 2, "ja"},
+		{"jane", 0, ""},
+		{"jane", -3, ""},
+		{"héllo", 2, "h"},
+		{"héllo", 3, "hé"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateRunes(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"book-management-api/config"
+	"book-management-api/models"
+	"book-management-api/slug"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrganizationHandler manages the organizations (tenants). Its routes are only
+// open to super administrators, so its queries are not scoped to the
+// caller's organization.
+type OrganizationHandler struct {
+	DB  *sql.DB
+	Cfg *config.Config
+}
+
+func NewOrganizationHandler(db *sql.DB, cfg *config.Config) *OrganizationHandler {
+	return &OrganizationHandler{
+		DB:  db,
+		Cfg: cfg,
+	}
+}
+
+const organizationColumns = `id, name, slug, created_at, created_by, modified_at, modified_by`
+
+func scanOrganization(row rowScanner, organization *models.Organization) error {
+	return row.Scan(
+		&organization.ID,
+		&organization.Name,
+		&organization.Slug,
+		&organization.CreatedAt,
+		&organization.CreatedBy,
+		&organization.ModifiedAt,
+		&organization.ModifiedBy,
+	)
+}
+
+// organizationIDBySlug returns the ID of the organization with slug, or
+// sql.ErrNoRows when there is none
+func organizationIDBySlug(q rowQueryer, slug string) (int, error) {
+	var id int
+	err := q.QueryRow("SELECT id FROM organizations WHERE slug = $1", slug).Scan(&id)
+	return id, err
+}
+
+// GetAll lists the organizations. With ?with=stats every organization also
+// carries the number of its users, categories and books.
+func (h *OrganizationHandler) GetAll(c *gin.Context) {
+	withStats := false
+	for _, with := range strings.Split(c.Query("with"), ",") {
+		if strings.TrimSpace(with) == "stats" {
+			withStats = true
+		}
+	}
+
+	query := `SELECT ` + organizationColumns + ` FROM organizations ORDER BY id ASC`
+	if withStats {
+		query = `
+			SELECT o.id, o.name, o.slug, o.created_at, o.created_by, o.modified_at, o.modified_by,
+				   (SELECT COUNT(*) FROM users WHERE organization_id = o.id),
+				   (SELECT COUNT(*) FROM categories WHERE organization_id = o.id),
+				   (SELECT COUNT(*) FROM books WHERE organization_id = o.id)
+			FROM organizations o
+			ORDER BY o.id ASC
+		`
+	}
+
+	rows, err := h.DB.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch organizations",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	organizations := []models.Organization{}
+	for rows.Next() {
+		var organization models.Organization
+		dest := []interface{}{
+			&organization.ID,
+			&organization.Name,
+			&organization.Slug,
+			&organization.CreatedAt,
+			&organization.CreatedBy,
+			&organization.ModifiedAt,
+			&organization.ModifiedBy,
+		}
+
+		var stats models.OrganizationStats
+		if withStats {
+			dest = append(dest, &stats.UserCount, &stats.CategoryCount, &stats.BookCount)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan organization",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		if withStats {
+			organization.Stats = &stats
+		}
+		organizations = append(organizations, organization)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Organizations retrieved successfully",
+		Data:    organizations,
+	})
+}
+
+// GetByID returns an organization with the number of its users, categories
+// and books
+func (h *OrganizationHandler) GetByID(c *gin.Context) {
+	organization, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.stats(organization.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to count organization data",
+			Error:   err.Error(),
+		})
+		return
+	}
+	organization.Stats = stats
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Organization retrieved successfully",
+		Data:    organization,
+	})
+}
+
+// Create adds an empty organization. Its first administrator is created
+// through POST /api/admin/users with its organization_id.
+func (h *OrganizationHandler) Create(c *gin.Context) {
+	input, ok := bindOrganizationInput(c, "")
+	if !ok {
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var organization models.Organization
+	err = scanOrganization(tx.QueryRow(`
+		INSERT INTO organizations (name, slug, created_by, modified_by)
+		VALUES ($1, $2, $3, $3)
+		RETURNING `+organizationColumns,
+		input.Name, input.Slug, username), &organization)
+	if err == nil {
+		err = recordAudit(tx, "organization", organization.ID, "create", gin.H{"name": organization.Name, "slug": organization.Slug}, username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if isUniqueViolation(err) {
+		respondOrganizationSlugTaken(c, input.Slug)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create organization",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Organization created successfully",
+		Data:    organization,
+	})
+}
+
+// Update renames an organization. A new slug changes the organization
+// parameter its public routes expect. The default organization keeps its
+// slug, which DEFAULT_ORGANIZATION refers to.
+func (h *OrganizationHandler) Update(c *gin.Context) {
+	organization, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	input, ok := bindOrganizationInput(c, organization.Slug)
+	if !ok {
+		return
+	}
+
+	if organization.Slug == h.Cfg.Tenancy.DefaultOrganization && input.Slug != organization.Slug {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Cannot change slug",
+			Error:   "the slug of the default organization is set by DEFAULT_ORGANIZATION",
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	previous := gin.H{"name": organization.Name, "slug": organization.Slug}
+	err = scanOrganization(tx.QueryRow(`
+		UPDATE organizations
+		SET name = $1, slug = $2, modified_at = CURRENT_TIMESTAMP, modified_by = $3
+		WHERE id = $4
+		RETURNING `+organizationColumns,
+		input.Name, input.Slug, username, organization.ID), organization)
+	if err == nil {
+		err = recordAudit(tx, "organization", organization.ID, "update", gin.H{
+			"previous": previous,
+			"name":     organization.Name,
+			"slug":     organization.Slug,
+		}, username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if isUniqueViolation(err) {
+		respondOrganizationSlugTaken(c, input.Slug)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update organization",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Organization updated successfully",
+		Data:    organization,
+	})
+}
+
+// Delete removes an empty organization. Organizations that still have users,
+// categories or books are refused with 409. The caller's own and the default
+// organization cannot be deleted.
+func (h *OrganizationHandler) Delete(c *gin.Context) {
+	organization, ok := h.findOrganization(c)
+	if !ok {
+		return
+	}
+
+	var refusal string
+	switch {
+	case organization.ID == currentOrganizationID(c):
+		refusal = "administrators cannot delete their own organization"
+	case organization.Slug == h.Cfg.Tenancy.DefaultOrganization:
+		refusal = "the default organization takes new registrations and cannot be deleted"
+	}
+	if refusal != "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Cannot delete organization",
+			Error:   refusal,
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the organization so no users or records are added meanwhile
+	if _, err := tx.Exec("SELECT id FROM organizations WHERE id = $1 FOR UPDATE", organization.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to lock organization",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	stats, err := h.stats(organization.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to count organization data",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if stats.UserCount > 0 || stats.CategoryCount > 0 || stats.BookCount > 0 {
+		organization.Stats = stats
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Organization is not empty",
+			Data:    organization,
+			Error:   "delete or move its users, categories and books first",
+		})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM organizations WHERE id = $1", organization.ID)
+	if err == nil {
+		err = recordAudit(tx, "organization", organization.ID, "delete", gin.H{"name": organization.Name, "slug": organization.Slug}, username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete organization",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Organization deleted successfully",
+	})
+}
+
+// findOrganization loads the organization addressed by the :id route
+// parameter
+func (h *OrganizationHandler) findOrganization(c *gin.Context) (*models.Organization, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid organization ID",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	var organization models.Organization
+	err = scanOrganization(h.DB.QueryRow(`SELECT `+organizationColumns+` FROM organizations WHERE id = $1`, id), &organization)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Organization not found",
+			Error:   "organization with specified ID does not exist",
+		})
+		return nil, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch organization",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	return &organization, true
+}
+
+// stats counts the users, categories and books of organization id
+func (h *OrganizationHandler) stats(id int) (*models.OrganizationStats, error) {
+	var stats models.OrganizationStats
+	err := h.DB.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM users WHERE organization_id = $1),
+			   (SELECT COUNT(*) FROM categories WHERE organization_id = $1),
+			   (SELECT COUNT(*) FROM books WHERE organization_id = $1)
+	`, id).Scan(&stats.UserCount, &stats.CategoryCount, &stats.BookCount)
+	return &stats, err
+}
+
+// bindOrganizationInput reads and normalizes the request body. Without a slug
+// it keeps currentSlug, or derives one from the name for new organizations.
+// It writes a response and returns false when the body is invalid.
+func bindOrganizationInput(c *gin.Context, currentSlug string) (*models.OrganizationInput, bool) {
+	var input models.OrganizationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Slug == "" {
+		input.Slug = currentSlug
+	}
+	if input.Slug == "" {
+		input.Slug = input.Name
+	}
+	input.Slug = slug.Make(input.Slug)
+
+	if input.Name == "" || input.Slug == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   "name and slug must contain letters or digits",
+		})
+		return nil, false
+	}
+	return &input, true
+}
+
+func respondOrganizationSlugTaken(c *gin.Context, slug string) {
+	c.JSON(http.StatusConflict, models.APIResponse{
+		Success: false,
+		Message: "Organization slug already exists",
+		Error:   "an organization with the slug '" + slug + "' already exists",
+	})
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"book-management-api/models"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions checked by the ownership policy, named like the permissions
+const (
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+// ownedResource is a table whose records belong to the user in
+// created_by_user_id. Its name is also the prefix of its permissions.
+type ownedResource struct {
+	table  string
+	entity string // audit_logs entity type
+	title  string // used in response messages
+}
+
+var (
+	ownedBooks      = ownedResource{table: "books", entity: "book", title: "Book"}
+	ownedCategories = ownedResource{table: "categories", entity: "category", title: "Category"}
+)
+
+// owner returns the owner of record id, nil when it has none. It returns
+// sql.ErrNoRows when the record does not exist in the request's
+// organization. Inside a transaction the row is locked until the end of it.
+func (r ownedResource) owner(c *gin.Context, q rowQueryer, id int) (*int, error) {
+	lock := ""
+	if _, ok := q.(*sql.Tx); ok {
+		lock = " FOR UPDATE"
+	}
+
+	var ownerID *int
+	err := q.QueryRow("SELECT created_by_user_id FROM "+r.table+" WHERE id = $1 AND organization_id = $2"+lock,
+		id, currentOrganizationID(c)).Scan(&ownerID)
+	return ownerID, err
+}
+
+// allows applies the ownership policy: the permission for action, e.g.
+// books:delete, covers every record, while the owner of a record only needs
+// the create permission. Records without an owner need the permission.
+func (r ownedResource) allows(c *gin.Context, action string, ownerID *int) bool {
+	if hasPermission(c, r.table+":"+action) {
+		return true
+	}
+
+	userID, ok := currentUserID(c)
+	return ok && ownerID != nil && *ownerID == userID && hasPermission(c, r.table+":create")
+}
+
+// respondIfNotAllowed writes a 403 response when the policy refuses action.
+// It reports whether a response was written.
+func (r ownedResource) respondIfNotAllowed(c *gin.Context, action string, ownerID *int) bool {
+	if r.allows(c, action, ownerID) {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, models.APIResponse{
+		Success: false,
+		Message: "Insufficient permissions",
+		Error:   "only the owner or users with the permission " + r.table + ":" + action + " may " + action + " this " + r.entity,
+	})
+	return true
+}
+
+// respondNotFound writes the 404 response for a missing record
+func (r ownedResource) respondNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.APIResponse{
+		Success: false,
+		Message: r.title + " not found",
+		Error:   r.entity + " with specified ID does not exist",
+	})
+}
+
+// respondOwnerLookup writes the response for a failed owner lookup
+func (r ownedResource) respondOwnerLookup(c *gin.Context, err error) {
+	if err == sql.ErrNoRows {
+		r.respondNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, models.APIResponse{
+		Success: false,
+		Message: "Failed to fetch " + r.entity,
+		Error:   err.Error(),
+	})
+}
+
+// transferOwnership hands record id over to the user in the request body and
+// records an audit entry. Only the owner and users who may delete any record
+// can give a record away. The new owner must be an active member of the same
+// organization and able to create such records, otherwise they could not
+// manage it. It commits the caller's tenant transaction tx.
+func (r ownedResource) transferOwnership(c *gin.Context, tx *sql.Tx, id int) {
+	var input models.OwnershipTransferInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	previousOwnerID, err := r.owner(c, tx, id)
+	if err != nil {
+		r.respondOwnerLookup(c, err)
+		return
+	}
+
+	if r.respondIfNotAllowed(c, actionDelete, previousOwnerID) {
+		return
+	}
+
+	var (
+		newOwner  string
+		status    string
+		canCreate bool
+	)
+	err = tx.QueryRow(`
+		SELECT u.username, u.status,
+			   EXISTS(SELECT 1 FROM role_permissions WHERE role_name = u.role AND permission_name = $2)
+		FROM users u
+		WHERE u.id = $1 AND u.organization_id = $3
+	`, input.UserID, r.table+":create", currentOrganizationID(c)).Scan(&newOwner, &status, &canCreate)
+
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var invalid string
+	switch {
+	case err == sql.ErrNoRows:
+		invalid = "user with specified ID does not exist in this organization"
+	case status != "active":
+		invalid = "user account is " + status
+	case !canCreate:
+		invalid = "the user's role lacks the permission " + r.table + ":create"
+	}
+	if invalid != "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid new owner",
+			Error:   invalid,
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	_, err = tx.Exec(`
+		UPDATE `+r.table+`
+		SET created_by_user_id = $1, modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE id = $3
+	`, input.UserID, username, id)
+	if err == nil {
+		err = recordAudit(tx, r.entity, id, "transfer_ownership", gin.H{
+			"previous_owner_id": previousOwnerID,
+			"owner_id":          input.UserID,
+			"owner_username":    newOwner,
+		}, username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to transfer ownership",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: r.title + " ownership transferred successfully",
+		Data: models.OwnershipTransferResult{
+			PreviousOwnerID: previousOwnerID,
+			OwnerID:         input.UserID,
+			OwnerUsername:   newOwner,
+		},
+	})
+}
+
+// hasPermission reports whether the authenticated user's role, or API key,
+// grants permission
+func hasPermission(c *gin.Context, permission string) bool {
+	permissions, _ := c.Get("permissions")
+	granted, _ := permissions.([]string)
+	for _, p := range granted {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ownerOf returns the authenticated user as the owner of a new record, or
+// nil when the request is not tied to a user
+func ownerOf(c *gin.Context) *int {
+	if userID, ok := currentUserID(c); ok {
+		return &userID
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/mail"
+	"book-management-api/models"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChangePassword sets a new password for the authenticated user after
+// checking the current one. Other sessions end; the response carries fresh
+// tokens for this one.
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	err := scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Wrong current passwords count like failed logins, so a stolen token
+	// cannot be used to guess the password
+	if !h.checkPasswordThrottled(c, &user, req.CurrentPassword) {
+		return
+	}
+
+	problems := h.PasswordPolicy.Validate(req.NewPassword, user.Username)
+	if req.NewPassword == req.CurrentPassword {
+		problems = append(problems, "must differ from the current password")
+	}
+
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid password",
+			Error:   "password " + strings.Join(problems, "; password "),
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to hash password",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	err = scanUser(tx.QueryRow(`
+		UPDATE users
+		SET password = $1, must_change_password = FALSE, token_version = token_version + 1,
+			modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE id = $3
+		RETURNING `+userColumns,
+		string(hashedPassword), user.Username, user.ID), &user)
+
+	var permissions []string
+	if err == nil {
+		permissions, err = rolePermissions(tx, user.Role)
+	}
+
+	var response *models.LoginResponse
+	if err == nil {
+		response, _, err = h.issueTokens(tx, c, &user, permissions, "")
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to change password",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password changed successfully",
+		Data:    response,
+	})
+}
+
+// ForgotPassword mails a one-time reset link to the account with the given
+// username or email. The response is the same whether or not an account was
+// found, so it cannot be used to discover accounts.
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Username == "" && req.Email == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   "username or email is required",
+		})
+		return
+	}
+
+	var user models.User
+	err := scanUser(h.DB.QueryRow(`
+		SELECT `+userColumns+` FROM users
+		WHERE (($1 <> '' AND LOWER(username) = LOWER($1)) OR ($2 <> '' AND LOWER(email) = LOWER($2)))
+		  AND status = 'active' AND email IS NOT NULL
+		LIMIT 1
+	`, req.Username, req.Email), &user)
+
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Issued and mailed in the background, so the response takes as long
+	// whether or not the account exists. Failures are not reported to the
+	// client either, which would reveal that the account exists.
+	if err == nil {
+		ipAddress := c.ClientIP()
+		go func() {
+			if err := h.sendPasswordReset(&user, ipAddress); err != nil {
+				log.Printf("Failed to send password reset for user %d: %v", user.ID, err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "If the account exists and has an email address, a password reset link has been sent",
+	})
+}
+
+// sendPasswordReset replaces any outstanding reset token of user with a new
+// one, requested from ipAddress, and mails it. While the last link is unused
+// and younger than the resend interval nothing is sent, so repeated requests
+// can neither flood the inbox nor keep cancelling the link just mailed.
+func (h *UserHandler) sendPasswordReset(user *models.User, ipAddress string) error {
+	token, err := generateToken(32)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so concurrent requests see each other's tokens
+	if _, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", user.ID); err != nil {
+		return err
+	}
+
+	var recent bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM password_reset_tokens
+			WHERE user_id = $1 AND used_at IS NULL
+			  AND created_at > CURRENT_TIMESTAMP - make_interval(secs => $2)
+		)
+	`, user.ID, h.Cfg.PasswordReset.ResendInterval.Seconds()).Scan(&recent)
+	if err != nil || recent {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL", user.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, ip_address)
+		VALUES ($1, $2, $3, $4)
+	`, user.ID, auth.HashToken(token), time.Now().Add(h.Cfg.PasswordReset.TokenTTL).UTC(), ipAddress)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return h.Mailer.Send(mail.Message{
+		To:      *user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Someone asked to reset the password of your account. Use the link below within %d minutes to choose a new one:\n\n"+
+			"%s%s\n\n"+
+			"If you did not ask for this, you can ignore this email.\n",
+			user.Username, int(h.Cfg.PasswordReset.TokenTTL.Minutes()), h.Cfg.PasswordReset.URL, token),
+	})
+}
+
+// ResetPassword sets a new password using a token from a reset mail. The
+// token works once and every session of the user ends.
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID, userID int
+		expiresAt       time.Time
+		usedAt          *time.Time
+	)
+	err = tx.QueryRow(`
+		SELECT id, user_id, expires_at, used_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, auth.HashToken(req.Token)).Scan(&tokenID, &userID, &expiresAt, &usedAt)
+
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reset token",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err == sql.ErrNoRows || usedAt != nil || time.Now().After(expiresAt) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid reset token",
+			Error:   "the reset token is invalid, expired or already used",
+		})
+		return
+	}
+
+	var user models.User
+	err = scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if problems := h.PasswordPolicy.Validate(req.NewPassword, user.Username); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid password",
+			Error:   "password " + strings.Join(problems, "; password "),
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to hash password",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET password = $1, must_change_password = FALSE, token_version = token_version + 1,
+			modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE id = $3
+	`, string(hashedPassword), "password-reset", user.ID)
+	if err == nil {
+		_, err = tx.Exec("UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL", user.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reset password",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password reset successfully, please log in with the new password",
+	})
+}
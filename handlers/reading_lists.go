@@ -0,0 +1,977 @@
+package handlers
+
+import (
+	"book-management-api/models"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReadingListHandler struct {
+	DB *sql.DB
+
+	// AdminDB is not restricted to one organization. It only finds the
+	// organization of a shared list, whose link does not name it.
+	AdminDB *sql.DB
+}
+
+func NewReadingListHandler(db, adminDB *sql.DB) *ReadingListHandler {
+	return &ReadingListHandler{
+		DB:      db,
+		AdminDB: adminDB,
+	}
+}
+
+const readingListColumns = `id, user_id, name, description, kind, visibility, share_token,
+	created_at, created_by, modified_at, modified_by`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReadingList(row rowScanner, list *models.ReadingList) error {
+	return row.Scan(
+		&list.ID,
+		&list.UserID,
+		&list.Name,
+		&list.Description,
+		&list.Kind,
+		&list.Visibility,
+		&list.ShareToken,
+		&list.CreatedAt,
+		&list.CreatedBy,
+		&list.ModifiedAt,
+		&list.ModifiedBy,
+	)
+}
+
+// GetAll returns the lists owned by the authenticated user
+func (h *ReadingListHandler) GetAll(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT `+readingListColumns+` FROM reading_lists WHERE user_id = $1 ORDER BY id ASC`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading lists",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	lists := []models.ReadingList{}
+	for rows.Next() {
+		var list models.ReadingList
+		if err := scanReadingList(rows, &list); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan reading list",
+				Error:   err.Error(),
+			})
+			return
+		}
+		lists = append(lists, list)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading lists retrieved successfully",
+		Data:    lists,
+	})
+}
+
+// GetPublic returns every public list of the organization, without share tokens
+func (h *ReadingListHandler) GetPublic(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT `+readingListColumns+`
+		FROM reading_lists
+		WHERE visibility = 'public' AND user_id IN (SELECT id FROM users WHERE organization_id = $1)
+		ORDER BY id ASC
+	`, currentOrganizationID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading lists",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	lists := []models.ReadingList{}
+	for rows.Next() {
+		var list models.ReadingList
+		if err := scanReadingList(rows, &list); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan reading list",
+				Error:   err.Error(),
+			})
+			return
+		}
+		list.ShareToken = ""
+		lists = append(lists, list)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading lists retrieved successfully",
+		Data:    lists,
+	})
+}
+
+// GetShared returns an unlisted or public list by its share token. It does not
+// require authentication.
+func (h *ReadingListHandler) GetShared(c *gin.Context) {
+	token := c.Param("token")
+
+	// The list is read in the organization of its owner
+	var organizationID int
+	err := h.AdminDB.QueryRow(`
+		SELECT u.organization_id
+		FROM reading_lists l
+		JOIN users u ON l.user_id = u.id
+		WHERE l.share_token = $1
+	`, token).Scan(&organizationID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.Set("organization_id", organizationID)
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	var list models.ReadingList
+	err = scanReadingList(tx.QueryRow(`
+		SELECT `+readingListColumns+`
+		FROM reading_lists
+		WHERE share_token = $1 AND visibility IN ('unlisted', 'public')
+	`, token), &list)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Reading list not found",
+			Error:   "no shared reading list exists for this link",
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	list.ShareToken = ""
+	h.respondWithItems(c, tx, &list)
+}
+
+// GetByID returns a list owned by the user, or any public list
+func (h *ReadingListHandler) GetByID(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	list, ok := h.findList(c, tx)
+	if !ok {
+		return
+	}
+
+	if list.UserID != userID {
+		if list.Visibility != "public" {
+			respondReadingListNotFound(c)
+			return
+		}
+		list.ShareToken = ""
+	}
+
+	h.respondWithItems(c, tx, list)
+}
+
+func (h *ReadingListHandler) Create(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var input models.ReadingListInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if input.Kind == "" {
+		input.Kind = "reading"
+	}
+	if input.Visibility == "" {
+		input.Visibility = "private"
+	}
+
+	shareToken, err := generateToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate share token",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	var list models.ReadingList
+	err = scanReadingList(tx.QueryRow(`
+		INSERT INTO reading_lists (user_id, name, description, kind, visibility, share_token, created_by, modified_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+readingListColumns,
+		userID, input.Name, input.Description, input.Kind, input.Visibility, shareToken, username, username), &list)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Reading list created successfully",
+		Data:    list,
+	})
+}
+
+func (h *ReadingListHandler) Update(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	list, ok := h.findOwnedList(c, tx)
+	if !ok {
+		return
+	}
+
+	var input models.ReadingListInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if input.Kind == "" {
+		input.Kind = list.Kind
+	}
+	if input.Visibility == "" {
+		input.Visibility = list.Visibility
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	err := scanReadingList(tx.QueryRow(`
+		UPDATE reading_lists
+		SET name = $1, description = $2, kind = $3, visibility = $4,
+			modified_at = CURRENT_TIMESTAMP, modified_by = $5
+		WHERE id = $6
+		RETURNING `+readingListColumns,
+		input.Name, input.Description, input.Kind, input.Visibility, username, list.ID), list)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading list updated successfully",
+		Data:    list,
+	})
+}
+
+func (h *ReadingListHandler) Delete(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	list, ok := h.findOwnedList(c, tx)
+	if !ok {
+		return
+	}
+
+	_, err := tx.Exec("DELETE FROM reading_lists WHERE id = $1", list.ID)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading list deleted successfully",
+	})
+}
+
+// RegenerateShareToken invalidates the current share link
+func (h *ReadingListHandler) RegenerateShareToken(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	list, ok := h.findOwnedList(c, tx)
+	if !ok {
+		return
+	}
+
+	shareToken, err := generateToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate share token",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	err = scanReadingList(tx.QueryRow(`
+		UPDATE reading_lists
+		SET share_token = $1, modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE id = $3
+		RETURNING `+readingListColumns,
+		shareToken, username, list.ID), list)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to regenerate share token",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Share token regenerated successfully",
+		Data:    list,
+	})
+}
+
+func (h *ReadingListHandler) AddItem(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	list, ok := h.findOwnedList(c, tx)
+	if !ok {
+		return
+	}
+
+	var input models.ReadingListItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var bookExists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM books WHERE id = $1 AND organization_id = $2)",
+		input.BookID, currentOrganizationID(c)).Scan(&bookExists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to validate book",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !bookExists {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   "book with specified ID does not exist",
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	// Lock the list so concurrent additions get distinct positions
+	if _, err := tx.Exec("SELECT id FROM reading_lists WHERE id = $1 FOR UPDATE", list.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to lock reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	item := models.ReadingListItem{
+		ListID: list.ID,
+		BookID: input.BookID,
+		Note:   input.Note,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO reading_list_items (list_id, book_id, position, note, created_by, modified_by)
+		VALUES ($1, $2, (SELECT COALESCE(MAX(position), 0) + 1 FROM reading_list_items WHERE list_id = $1), $3, $4, $5)
+		RETURNING id, position, created_at, modified_at
+	`, list.ID, input.BookID, input.Note, username, username).Scan(
+		&item.ID,
+		&item.Position,
+		&item.CreatedAt,
+		&item.ModifiedAt,
+	)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Book already in reading list",
+			Error:   "a book can only appear once in a reading list",
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to add book to reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := touchReadingList(tx, list.ID, username); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to add book to reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	usernameStr := username.(string)
+	item.CreatedBy = &usernameStr
+	item.ModifiedBy = &usernameStr
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Book added to reading list successfully",
+		Data:    item,
+	})
+}
+
+func (h *ReadingListHandler) UpdateItem(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	list, ok := h.findOwnedList(c, tx)
+	if !ok {
+		return
+	}
+
+	bookID, err := strconv.Atoi(c.Param("bookId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var input models.ReadingListItemUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	var item models.ReadingListItem
+	err = tx.QueryRow(`
+		UPDATE reading_list_items
+		SET note = $1, modified_at = CURRENT_TIMESTAMP, modified_by = $2
+		WHERE list_id = $3 AND book_id = $4
+		RETURNING id, list_id, book_id, position, note, created_at, created_by, modified_at, modified_by
+	`, input.Note, username, list.ID, bookID).Scan(
+		&item.ID,
+		&item.ListID,
+		&item.BookID,
+		&item.Position,
+		&item.Note,
+		&item.CreatedAt,
+		&item.CreatedBy,
+		&item.ModifiedAt,
+		&item.ModifiedBy,
+	)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err == sql.ErrNoRows {
+		respondReadingListItemNotFound(c)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update reading list entry",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading list entry updated successfully",
+		Data:    item,
+	})
+}
+
+func (h *ReadingListHandler) RemoveItem(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	list, ok := h.findOwnedList(c, tx)
+	if !ok {
+		return
+	}
+
+	bookID, err := strconv.Atoi(c.Param("bookId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	var position int
+	err = tx.QueryRow(`
+		DELETE FROM reading_list_items WHERE list_id = $1 AND book_id = $2 RETURNING position
+	`, list.ID, bookID).Scan(&position)
+
+	if err == sql.ErrNoRows {
+		respondReadingListItemNotFound(c)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to remove book from reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Close the gap left by the removed entry
+	_, err = tx.Exec(`
+		UPDATE reading_list_items SET position = position - 1 WHERE list_id = $1 AND position > $2
+	`, list.ID, position)
+	if err == nil {
+		err = touchReadingList(tx, list.ID, username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to remove book from reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Book removed from reading list successfully",
+	})
+}
+
+// Reorder sets the order of all entries. The request must list every book in
+// the list exactly once.
+func (h *ReadingListHandler) Reorder(c *gin.Context) {
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	list, ok := h.findOwnedList(c, tx)
+	if !ok {
+		return
+	}
+
+	var input models.ReadingListOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	rows, err := tx.Query("SELECT book_id FROM reading_list_items WHERE list_id = $1 FOR UPDATE", list.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading list entries",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	current := map[int]bool{}
+	for rows.Next() {
+		var bookID int
+		if err := rows.Scan(&bookID); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan reading list entry",
+				Error:   err.Error(),
+			})
+			return
+		}
+		current[bookID] = true
+	}
+	rows.Close()
+
+	seen := map[int]bool{}
+	for _, bookID := range input.BookIDs {
+		if !current[bookID] || seen[bookID] {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid order",
+				Error:   "book_ids must contain every book in the list exactly once",
+			})
+			return
+		}
+		seen[bookID] = true
+	}
+	if len(seen) != len(current) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid order",
+			Error:   "book_ids must contain every book in the list exactly once",
+		})
+		return
+	}
+
+	for i, bookID := range input.BookIDs {
+		_, err := tx.Exec(`
+			UPDATE reading_list_items
+			SET position = $1, modified_at = CURRENT_TIMESTAMP, modified_by = $2
+			WHERE list_id = $3 AND book_id = $4
+		`, i+1, username, list.ID, bookID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to reorder reading list",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := touchReadingList(tx, list.ID, username); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	list.Items, err = readingListItems(tx, list.ID)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reorder reading list",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading list retrieved successfully",
+		Data:    list,
+	})
+}
+
+// findList loads the list addressed by the :id route parameter. Lists of
+// other organizations are reported as not found.
+func (h *ReadingListHandler) findList(c *gin.Context, q rowQueryer) (*models.ReadingList, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid reading list ID",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	var list models.ReadingList
+	err = scanReadingList(q.QueryRow(`
+		SELECT `+readingListColumns+`
+		FROM reading_lists
+		WHERE id = $1 AND user_id IN (SELECT id FROM users WHERE organization_id = $2)
+	`, id, currentOrganizationID(c)), &list)
+
+	if err == sql.ErrNoRows {
+		respondReadingListNotFound(c)
+		return nil, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading list",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+
+	return &list, true
+}
+
+// findOwnedList is like findList but only succeeds for the list's owner. Lists
+// of other users are reported as not found.
+func (h *ReadingListHandler) findOwnedList(c *gin.Context, q rowQueryer) (*models.ReadingList, bool) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	list, ok := h.findList(c, q)
+	if !ok {
+		return nil, false
+	}
+
+	if list.UserID != userID {
+		respondReadingListNotFound(c)
+		return nil, false
+	}
+
+	return list, true
+}
+
+// respondWithItems writes list with its entries as the response
+func (h *ReadingListHandler) respondWithItems(c *gin.Context, q queryer, list *models.ReadingList) {
+	items, err := readingListItems(q, list.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading list entries",
+			Error:   err.Error(),
+		})
+		return
+	}
+	list.Items = items
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading list retrieved successfully",
+		Data:    list,
+	})
+}
+
+// readingListItems returns the entries of list listID in their order
+func readingListItems(q queryer, listID int) ([]models.ReadingListItem, error) {
+	rows, err := q.Query(`
+		SELECT i.id, i.list_id, i.book_id, i.position, i.note,
+			   i.created_at, i.created_by, i.modified_at, i.modified_by,
+			   b.title as book_title
+		FROM reading_list_items i
+		JOIN books b ON i.book_id = b.id
+		WHERE i.list_id = $1
+		ORDER BY i.position ASC
+	`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.ReadingListItem{}
+	for rows.Next() {
+		var item models.ReadingListItem
+		err := rows.Scan(
+			&item.ID,
+			&item.ListID,
+			&item.BookID,
+			&item.Position,
+			&item.Note,
+			&item.CreatedAt,
+			&item.CreatedBy,
+			&item.ModifiedAt,
+			&item.ModifiedBy,
+			&item.BookTitle,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func touchReadingList(tx *sql.Tx, listID int, username interface{}) error {
+	_, err := tx.Exec(`
+		UPDATE reading_lists SET modified_at = CURRENT_TIMESTAMP, modified_by = $1 WHERE id = $2
+	`, username, listID)
+	return err
+}
+
+func respondReadingListNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.APIResponse{
+		Success: false,
+		Message: "Reading list not found",
+		Error:   "reading list with specified ID does not exist",
+	})
+}
+
+func respondReadingListItemNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.APIResponse{
+		Success: false,
+		Message: "Reading list entry not found",
+		Error:   "book is not in this reading list",
+	})
+}
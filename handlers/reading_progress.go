@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"book-management-api/models"
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReadingProgressHandler struct {
+	DB *sql.DB
+}
+
+func NewReadingProgressHandler(db *sql.DB) *ReadingProgressHandler {
+	return &ReadingProgressHandler{DB: db}
+}
+
+const readingProgressQuery = `
+	SELECT p.id, p.user_id, p.book_id, p.current_page, p.percentage, p.status,
+		   p.started_at, p.finished_at, p.created_at, p.created_by, p.modified_at, p.modified_by,
+		   b.title as book_title, COALESCE(b.total_page, 0) as total_page
+	FROM reading_progress p
+	JOIN books b ON p.book_id = b.id
+`
+
+func scanReadingProgress(row rowScanner, progress *models.ReadingProgress) error {
+	return row.Scan(
+		&progress.ID,
+		&progress.UserID,
+		&progress.BookID,
+		&progress.CurrentPage,
+		&progress.Percentage,
+		&progress.Status,
+		&progress.StartedAt,
+		&progress.FinishedAt,
+		&progress.CreatedAt,
+		&progress.CreatedBy,
+		&progress.ModifiedAt,
+		&progress.ModifiedBy,
+		&progress.BookTitle,
+		&progress.TotalPage,
+	)
+}
+
+// Get returns the authenticated user's progress on a book
+func (h *ReadingProgressHandler) Get(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	var progress models.ReadingProgress
+	err = scanReadingProgress(tx.QueryRow(readingProgressQuery+` WHERE p.user_id = $1 AND p.book_id = $2`, userID, bookID), &progress)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Reading progress not found",
+			Error:   "no reading progress recorded for this book",
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading progress",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading progress retrieved successfully",
+		Data:    progress,
+	})
+}
+
+// Upsert records progress on a book. Either current_page or percentage may be
+// sent and the other one is derived from the book's total_page. Fields that are
+// omitted keep their previous value.
+func (h *ReadingProgressHandler) Upsert(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var input models.ReadingProgressInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	var totalPage sql.NullInt64
+	err = tx.QueryRow("SELECT total_page FROM books WHERE id = $1 AND organization_id = $2",
+		bookID, currentOrganizationID(c)).Scan(&totalPage)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Book not found",
+			Error:   "book with specified ID does not exist",
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch book",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Start from the stored progress so partial updates keep earlier values
+	progress := models.ReadingProgress{
+		UserID:    userID,
+		BookID:    bookID,
+		Status:    "reading",
+		StartedAt: today(),
+	}
+	err = scanReadingProgress(tx.QueryRow(readingProgressQuery+` WHERE p.user_id = $1 AND p.book_id = $2`, userID, bookID), &progress)
+	isNew := err == sql.ErrNoRows
+	if err != nil && !isNew {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading progress",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	total := int(totalPage.Int64)
+	if input.CurrentPage != nil {
+		if total > 0 && *input.CurrentPage > total {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid current page",
+				Error:   "current_page cannot exceed the book's total_page",
+			})
+			return
+		}
+		progress.CurrentPage = *input.CurrentPage
+		if total > 0 {
+			progress.Percentage = math.Round(float64(progress.CurrentPage)*10000/float64(total)) / 100
+		}
+	} else if input.Percentage != nil {
+		progress.Percentage = *input.Percentage
+		progress.CurrentPage = int(math.Round(progress.Percentage * float64(total) / 100))
+	}
+
+	if input.StartedAt != nil {
+		progress.StartedAt, _ = time.Parse("2006-01-02", *input.StartedAt)
+	}
+
+	finished := progress.Status == "finished"
+	if input.CurrentPage != nil || input.Percentage != nil {
+		finished = progress.Percentage >= 100
+	}
+	if input.FinishedAt != nil {
+		finished = true
+	}
+	if input.Finished != nil {
+		finished = *input.Finished
+	}
+
+	if finished {
+		progress.Status = "finished"
+		progress.Percentage = 100
+		if total > 0 {
+			progress.CurrentPage = total
+		}
+		if input.FinishedAt != nil {
+			finishedAt, _ := time.Parse("2006-01-02", *input.FinishedAt)
+			progress.FinishedAt = &finishedAt
+		} else if progress.FinishedAt == nil {
+			finishedAt := today()
+			progress.FinishedAt = &finishedAt
+		}
+
+		// A book logged as finished in the past was started then at the latest
+		if isNew && input.StartedAt == nil {
+			progress.StartedAt = *progress.FinishedAt
+		}
+	} else {
+		progress.Status = "reading"
+		progress.FinishedAt = nil
+		if progress.Percentage >= 100 {
+			progress.Percentage = 99.99
+		}
+		// Unfinished books stop before the last page, matching the percentage
+		if total > 0 && progress.CurrentPage >= total {
+			progress.CurrentPage = total - 1
+			progress.Percentage = math.Round(float64(progress.CurrentPage)*10000/float64(total)) / 100
+		}
+	}
+
+	if progress.FinishedAt != nil && progress.FinishedAt.Before(progress.StartedAt) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid dates",
+			Error:   "finished_at cannot be before started_at",
+		})
+		return
+	}
+
+	username, exists := c.Get("username")
+	if !exists {
+		username = "system"
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO reading_progress (user_id, book_id, current_page, percentage, status, started_at, finished_at, created_by, modified_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id, book_id) DO UPDATE
+		SET current_page = EXCLUDED.current_page,
+			percentage = EXCLUDED.percentage,
+			status = EXCLUDED.status,
+			started_at = EXCLUDED.started_at,
+			finished_at = EXCLUDED.finished_at,
+			modified_at = CURRENT_TIMESTAMP,
+			modified_by = EXCLUDED.modified_by
+	`, userID, bookID, progress.CurrentPage, progress.Percentage, progress.Status, progress.StartedAt, progress.FinishedAt, username, username)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to save reading progress",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	err = scanReadingProgress(tx.QueryRow(readingProgressQuery+` WHERE p.user_id = $1 AND p.book_id = $2`, userID, bookID), &progress)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading progress",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading progress saved successfully",
+		Data:    progress,
+	})
+}
+
+func (h *ReadingProgressHandler) Delete(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid book ID",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM reading_progress WHERE user_id = $1 AND book_id = $2", userID, bookID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete reading progress",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Reading progress not found",
+			Error:   "no reading progress recorded for this book",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading progress deleted successfully",
+	})
+}
+
+// GetMine returns the user's in-progress and finished books together with
+// yearly totals of finished books and their pages
+func (h *ReadingProgressHandler) GetMine(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, ok := tenantTx(c, h.DB)
+	if !ok {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(readingProgressQuery+`
+		WHERE p.user_id = $1
+		ORDER BY p.finished_at DESC NULLS FIRST, p.modified_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch reading progress",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	overview := models.ReadingOverview{
+		InProgress: []models.ReadingProgress{},
+		Finished:   []models.ReadingProgress{},
+		Yearly:     []models.ReadingYearSummary{},
+	}
+	for rows.Next() {
+		var progress models.ReadingProgress
+		if err := scanReadingProgress(rows, &progress); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan reading progress",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		if progress.Status == "finished" {
+			overview.Finished = append(overview.Finished, progress)
+		} else {
+			overview.InProgress = append(overview.InProgress, progress)
+		}
+	}
+
+	yearRows, err := tx.Query(`
+		SELECT EXTRACT(YEAR FROM p.finished_at)::int as year,
+			   COUNT(*) as books_read,
+			   COALESCE(SUM(b.total_page), 0) as pages_read
+		FROM reading_progress p
+		JOIN books b ON p.book_id = b.id
+		WHERE p.user_id = $1 AND p.status = 'finished' AND p.finished_at IS NOT NULL
+		GROUP BY year
+		ORDER BY year DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to calculate yearly totals",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer yearRows.Close()
+
+	for yearRows.Next() {
+		var summary models.ReadingYearSummary
+		if err := yearRows.Scan(&summary.Year, &summary.BooksRead, &summary.PagesRead); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan yearly totals",
+				Error:   err.Error(),
+			})
+			return
+		}
+		overview.Yearly = append(overview.Yearly, summary)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Reading history retrieved successfully",
+		Data:    overview,
+	})
+}
+
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"book-management-api/models"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type RoleHandler struct {
+	DB *sql.DB
+}
+
+func NewRoleHandler(db *sql.DB) *RoleHandler {
+	return &RoleHandler{DB: db}
+}
+
+// GetAll lists the roles together with the permissions they grant
+func (h *RoleHandler) GetAll(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT r.name, r.description,
+			   COALESCE(array_agg(rp.permission_name ORDER BY rp.permission_name) FILTER (WHERE rp.permission_name IS NOT NULL), '{}'),
+			   r.require_mfa
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_name = r.name
+		GROUP BY r.name, r.description, r.require_mfa
+		ORDER BY r.name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch roles",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.Name, &role.Description, pq.Array(&role.Permissions), &role.RequireMFA); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan role",
+				Error:   err.Error(),
+			})
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Roles retrieved successfully",
+		Data:    roles,
+	})
+}
+
+// SetMFARequirement turns the two-factor requirement of a role on or off.
+// Users of the role without two-factor authentication have to enrol at their
+// next login.
+func (h *RoleHandler) SetMFARequirement(c *gin.Context) {
+	var input models.RoleMFAInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.DB.Exec("UPDATE roles SET require_mfa = $1 WHERE name = $2", *input.Required, c.Param("name"))
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update role",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if affected == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Role not found",
+			Error:   "role '" + c.Param("name") + "' does not exist",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Role updated successfully",
+		Data:    gin.H{"name": c.Param("name"), "require_mfa": *input.Required},
+	})
+}
+
+// rolePermissions returns the names of the permissions granted to role
+func rolePermissions(db queryer, role string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT permission_name FROM role_permissions
+		WHERE role_name = $1
+		ORDER BY permission_name
+	`, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+// respondIfUnknownRole writes a 400 response when role does not exist. It
+// reports whether a response was written.
+func respondIfUnknownRole(c *gin.Context, db *sql.DB, role string) bool {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)", role).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return true
+	}
+
+	if !exists {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid role",
+			Error:   "role '" + role + "' does not exist",
+		})
+		return true
+	}
+	return false
+}
+
+// respondIfRoleReserved writes a 403 response when role grants
+// organizations:manage but the authenticated user lacks it. Only super
+// administrators may hand out, take away or act on accounts with that role,
+// since it reaches into every organization. It reports whether a response
+// was written.
+func respondIfRoleReserved(c *gin.Context, db *sql.DB, role string) bool {
+	if hasPermission(c, "organizations:manage") {
+		return false
+	}
+
+	var reserved bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM role_permissions WHERE role_name = $1 AND permission_name = 'organizations:manage')
+	`, role).Scan(&reserved)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return true
+	}
+
+	if reserved {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Insufficient permissions",
+			Error:   "only users with the permission organizations:manage may manage users with the role '" + role + "'",
+		})
+		return true
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"book-management-api/models"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Login methods recorded in login_events
+const (
+	loginMethodPassword = "password"
+	loginMethodMFA      = "mfa"
+	loginMethodOIDC     = "oidc"
+	loginMethodBasic    = "basic"
+)
+
+// recordLoginEvent writes a login_events entry. A userID of 0 is looked up by
+// username. Failures are only logged, so a login never fails because its
+// history could not be written.
+func recordLoginEvent(db execer, c *gin.Context, userID int, username, method string, success bool, failureReason, sessionID string) {
+	var id *int
+	if userID != 0 {
+		id = &userID
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO login_events (user_id, username, method, success, failure_reason, session_id, ip_address, user_agent, created_at)
+		VALUES (COALESCE($1, (SELECT id FROM users WHERE username = $2)), $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9)
+	`, id, truncate(username, 255), method, success, failureReason, sessionID, c.ClientIP(), c.Request.UserAgent(), time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to record login event for %q: %v", username, err)
+	}
+}
+
+// GetSessions lists the active sessions of the authenticated user. The
+// session of the request is marked as current.
+func (h *UserHandler) GetSessions(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := listSessions(h.DB, userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch sessions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Sessions retrieved successfully",
+		Data:    sessions,
+	})
+}
+
+// RevokeSession ends one session of the authenticated user, e.g. on a lost
+// device. Its refresh token stops working and so do its access tokens.
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	respondSessionRevoked(c, h.DB, userID, c.Param("session_id"))
+}
+
+// GetLogins lists the login attempts for a user, newest first. Query
+// parameters: success (true or false), from and to (RFC 3339 or YYYY-MM-DD),
+// page and page_size.
+func (h *AdminUserHandler) GetLogins(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid page parameter",
+			Error:   "page must be a positive integer",
+		})
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if err != nil || pageSize < 1 || pageSize > 200 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid page_size parameter",
+			Error:   "page_size must be between 1 and 200",
+		})
+		return
+	}
+
+	var success *bool
+	if value := c.Query("success"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid success parameter",
+				Error:   "success must be true or false",
+			})
+			return
+		}
+		success = &parsed
+	}
+
+	from, ok := parseTimeQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseTimeQuery(c, "to")
+	if !ok {
+		return
+	}
+
+	// Nil filters match every event
+	filter := `
+		WHERE user_id = $1
+		  AND ($2::boolean IS NULL OR success = $2)
+		  AND ($3::timestamp IS NULL OR created_at >= $3)
+		  AND ($4::timestamp IS NULL OR created_at < $4)
+	`
+	args := []interface{}{user.ID, success, from, to}
+
+	var total int
+	if err := h.DB.QueryRow(`SELECT COUNT(*) FROM login_events `+filter, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to count login events",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, user_id, username, method, success, failure_reason, session_id, ip_address, user_agent, created_at
+		FROM login_events `+filter+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5 OFFSET $6
+	`, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch login events",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.LoginEvent{}
+	for rows.Next() {
+		var event models.LoginEvent
+		err := rows.Scan(&event.ID, &event.UserID, &event.Username, &event.Method, &event.Success,
+			&event.FailureReason, &event.SessionID, &event.IPAddress, &event.UserAgent, &event.CreatedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to scan login event",
+				Error:   err.Error(),
+			})
+			return
+		}
+		events = append(events, event)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Login events retrieved successfully",
+		Data: models.PaginatedResponse{
+			Items:    events,
+			Page:     page,
+			PageSize: pageSize,
+			Total:    total,
+		},
+	})
+}
+
+// GetSessions lists the active sessions of a user
+func (h *AdminUserHandler) GetSessions(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := listSessions(h.DB, user.ID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch sessions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Sessions retrieved successfully",
+		Data:    sessions,
+	})
+}
+
+// RevokeSession ends one session of a user
+func (h *AdminUserHandler) RevokeSession(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	respondSessionRevoked(c, h.DB, user.ID, c.Param("session_id"))
+}
+
+// listSessions returns the sessions of userID that can still be refreshed,
+// most recently active first. A session is a refresh token family; its
+// newest token tells where it was last used.
+func listSessions(db *sql.DB, userID int, currentID string) ([]models.Session, error) {
+	rows, err := db.Query(`
+		SELECT family_id, MIN(created_at), MAX(created_at), MAX(expires_at),
+			   (array_agg(user_agent ORDER BY created_at DESC))[1],
+			   (array_agg(ip_address ORDER BY created_at DESC))[1]
+		FROM refresh_tokens
+		WHERE user_id = $1
+		  AND token_version = (SELECT token_version FROM users WHERE id = $1)
+		GROUP BY family_id
+		HAVING COUNT(*) FILTER (WHERE used_at IS NULL AND revoked_at IS NULL AND expires_at > $2) > 0
+		ORDER BY MAX(created_at) DESC
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.StartedAt, &session.LastActiveAt, &session.ExpiresAt,
+			&session.UserAgent, &session.IPAddress)
+		if err != nil {
+			return nil, err
+		}
+		session.Current = session.ID == currentID
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// respondSessionRevoked revokes every refresh token of the session and
+// writes the response. Access tokens of the session are rejected by JWTAuth
+// from then on.
+func respondSessionRevoked(c *gin.Context, db *sql.DB, userID int, sessionID string) {
+	result, err := db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+	`, userID, sessionID)
+
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to revoke session",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if affected == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Session not found",
+			Error:   "no active session with this ID",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Session revoked successfully",
+	})
+}
+
+// parseTimeQuery reads an optional RFC 3339 timestamp or YYYY-MM-DD date
+// from the query parameter name. It writes a 400 response and returns false
+// when the value cannot be parsed.
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			t = t.UTC()
+			return &t, true
+		}
+	}
+
+	c.JSON(http.StatusBadRequest, models.APIResponse{
+		Success: false,
+		Message: "Invalid " + name + " parameter",
+		Error:   name + " must be an RFC 3339 timestamp or a YYYY-MM-DD date",
+	})
+	return nil, false
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
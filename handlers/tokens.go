@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/models"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rowQueryer is implemented by both *sql.DB and *sql.Tx
+type rowQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// issueTokens creates a short-lived access token and a refresh token for user.
+// The refresh token joins familyID, or starts a new family when it is empty.
+// It returns the response body and the ID of the stored refresh token.
+func (h *UserHandler) issueTokens(db rowQueryer, c *gin.Context, user *models.User, permissions []string, familyID string) (*models.LoginResponse, int, error) {
+	jti, err := generateToken(16)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if familyID == "" {
+		if familyID, err = generateToken(16); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// The refresh token family is the session; sid ties the access token to it
+	now := time.Now()
+	tokenString, err := h.Keys.Sign(jwt.MapClaims{
+		"iss":         h.Cfg.Tokens.Issuer,
+		"aud":         h.Cfg.Tokens.Audience,
+		"user_id":     user.ID,
+		"username":    user.Username,
+		"role":        user.Role,
+		"permissions": permissions,
+		"org_id":      user.OrganizationID,
+		"tv":          user.TokenVersion,
+		"jti":         jti,
+		"sid":         familyID,
+		"exp":         now.Add(h.Cfg.Tokens.AccessTTL).Unix(),
+		"iat":         now.Unix(),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	refreshToken, err := generateToken(32)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var refreshID int
+	err = db.QueryRow(`
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, token_version, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, user.ID, auth.HashToken(refreshToken), familyID, now.Add(h.Cfg.Tokens.RefreshTTL).UTC(), user.TokenVersion,
+		c.Request.UserAgent(), c.ClientIP()).Scan(&refreshID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &models.LoginResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.Cfg.Tokens.AccessTTL.Seconds()),
+		User:         *user,
+		Permissions:  permissions,
+		SessionID:    familyID,
+	}, refreshID, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Each refresh token works once; using one again revokes every token
+// descended from the same login.
+func (h *UserHandler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID, userID, tokenVersion int
+		familyID                      string
+		expiresAt                     time.Time
+		usedAt, revokedAt             *time.Time
+	)
+	err = tx.QueryRow(`
+		SELECT id, user_id, family_id, expires_at, used_at, revoked_at, token_version
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, auth.HashToken(req.RefreshToken)).Scan(&tokenID, &userID, &familyID, &expiresAt, &usedAt, &revokedAt, &tokenVersion)
+
+	if err == sql.ErrNoRows {
+		respondInvalidRefreshToken(c, "refresh token is not valid")
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch refresh token",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if usedAt != nil {
+		// Somebody replayed a token that was already exchanged. Either the
+		// client or an attacker holds a stolen copy, so end the whole family.
+		_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL", familyID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to revoke refresh tokens",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		respondInvalidRefreshToken(c, "refresh token reuse detected, please log in again")
+		return
+	}
+
+	if revokedAt != nil {
+		respondInvalidRefreshToken(c, "refresh token has been revoked")
+		return
+	}
+
+	if time.Now().After(expiresAt) {
+		respondInvalidRefreshToken(c, "refresh token has expired")
+		return
+	}
+
+	var user models.User
+	err = scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to fetch user",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if user.Status != "active" || user.TokenVersion != tokenVersion {
+		respondInvalidRefreshToken(c, "refresh token has been revoked")
+		return
+	}
+
+	// The role may have changed since the last refresh
+	permissions, err := rolePermissions(tx, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to load permissions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	response, newTokenID, err := h.issueTokens(tx, c, &user, permissions, familyID)
+	if err == nil {
+		_, err = tx.Exec("UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP, replaced_by = $1 WHERE id = $2", newTokenID, tokenID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to refresh token",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Token refreshed successfully",
+		Data:    response,
+	})
+}
+
+// Logout revokes the access token of the request and, when given, the refresh
+// token of the same session
+func (h *UserHandler) Logout(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.LogoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	jti := c.GetString("jti")
+	expiresAt, _ := c.Get("token_expires_at")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start transaction",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// Revoked entries are only needed until the token would have expired
+	_, err = tx.Exec("DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP")
+	if err == nil {
+		_, err = tx.Exec(`
+			INSERT INTO revoked_tokens (jti, user_id, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (jti) DO NOTHING
+		`, jti, userID, expiresAt)
+	}
+	if err == nil && req.RefreshToken != "" {
+		_, err = tx.Exec(`
+			UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+			WHERE revoked_at IS NULL AND user_id = $1
+			  AND family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $2)
+		`, userID, auth.HashToken(req.RefreshToken))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to log out",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	})
+}
+
+// LogoutAll ends every session of the user by moving their token version
+// forward, which invalidates all access and refresh tokens issued so far
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := revokeUserTokens(h.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to log out all sessions",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "All sessions logged out successfully",
+	})
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// revokeUserTokens invalidates every access and refresh token of a user
+func revokeUserTokens(db execer, userID int) error {
+	_, err := db.Exec("UPDATE users SET token_version = token_version + 1 WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	return err
+}
+
+func respondInvalidRefreshToken(c *gin.Context, reason string) {
+	c.JSON(http.StatusUnauthorized, models.APIResponse{
+		Success: false,
+		Message: "Invalid refresh token",
+		Error:   reason,
+	})
+}
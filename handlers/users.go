@@ -1,29 +1,56 @@
 package handlers
 
 import (
+	"book-management-api/auth"
 	"book-management-api/config"
+	"book-management-api/mail"
 	"book-management-api/models"
 	"database/sql"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserHandler struct {
-	DB  *sql.DB
-	Cfg *config.Config
+	DB             *sql.DB
+	Cfg            *config.Config
+	PasswordPolicy *auth.PasswordPolicy
+	Mailer         mail.Mailer
+	Keys           *auth.KeyStore
 }
 
-func NewUserHandler(db *sql.DB, cfg *config.Config) *UserHandler {
+func NewUserHandler(db *sql.DB, cfg *config.Config, passwordPolicy *auth.PasswordPolicy, mailer mail.Mailer, keys *auth.KeyStore) *UserHandler {
 	return &UserHandler{
-		DB:  db,
-		Cfg: cfg,
+		DB:             db,
+		Cfg:            cfg,
+		PasswordPolicy: passwordPolicy,
+		Mailer:         mailer,
+		Keys:           keys,
 	}
 }
 
+const userColumns = `id, username, email, password, role, status, must_change_password, token_version, organization_id, created_at, created_by, modified_at, modified_by`
+
+func scanUser(row rowScanner, user *models.User) error {
+	return row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password,
+		&user.Role,
+		&user.Status,
+		&user.MustChangePassword,
+		&user.TokenVersion,
+		&user.OrganizationID,
+		&user.CreatedAt,
+		&user.CreatedBy,
+		&user.ModifiedAt,
+		&user.ModifiedBy,
+	)
+}
+
 func (h *UserHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -38,31 +65,72 @@ func (h *UserHandler) Login(c *gin.Context) {
 	// Log the login attempt for debugging
 	c.Header("Content-Type", "application/json")
 
+	// Refuse attempts from clients and for usernames with too many failures
+	ip := c.ClientIP()
+	remaining, err := h.loginBlockedFor(ip, req.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if remaining > 0 {
+		recordLoginEvent(h.DB, c, 0, req.Username, loginMethodPassword, false, "throttled", "")
+		respondLoginBlocked(c, remaining)
+		return
+	}
+
 	// Get user from database
 	var user models.User
-	query := `SELECT id, username, password, created_at, created_by, modified_at, modified_by 
-			  FROM users WHERE username = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
 	
-	err := h.DB.QueryRow(query, req.Username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Password,
-		&user.CreatedAt,
-		&user.CreatedBy,
-		&user.ModifiedAt,
-		&user.ModifiedBy,
-	)
+	err = scanUser(h.DB.QueryRow(query, req.Username), &user)
 
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Compare password. Unknown users get the same bcrypt work and the same
+	// response as a wrong password.
+	var passwordErr error
+	failureReason := "wrong_password"
 	if err == sql.ErrNoRows {
+		auth.CompareDummyPassword(req.Password)
+		passwordErr = bcrypt.ErrMismatchedHashAndPassword
+		failureReason = "unknown_user"
+	} else {
+		passwordErr = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	}
+
+	if passwordErr != nil {
+		recordLoginEvent(h.DB, c, user.ID, req.Username, loginMethodPassword, false, failureReason, "")
+
+		if err := h.recordLoginFailure(ip, req.Username); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Database error",
+				Error:   err.Error(),
+			})
+			return
+		}
+
 		c.JSON(http.StatusUnauthorized, models.APIResponse{
 			Success: false,
 			Message: "Invalid credentials",
-			Error:   "user not found",
+			Error:   "invalid username or password",
 		})
 		return
 	}
 
-	if err != nil {
+	if err := h.clearLoginFailures(req.Username); err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Message: "Database error",
@@ -71,51 +139,81 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, models.APIResponse{
+	// Only active accounts may log in
+	if respondIfInactive(c, &user) {
+		recordLoginEvent(h.DB, c, user.ID, user.Username, loginMethodPassword, false, "account_"+user.Status, "")
+		return
+	}
+
+	// Issue tokens, or an MFA challenge when a second factor is needed
+	h.completeLogin(c, &user, loginMethodPassword)
+}
+
+// Register creates an account for a new user with the default reader role in
+// the default organization. Anyone may call it, so it cannot join other
+// organizations; their admins create those accounts. When approval is
+// required the account stays pending until an admin approves it.
+func (h *UserHandler) Register(c *gin.Context) {
+	if !h.Cfg.Registration.Enabled {
+		c.JSON(http.StatusForbidden, models.APIResponse{
 			Success: false,
-			Message: "Invalid credentials",
-			Error:   "invalid password",
+			Message: "Registration is disabled",
+			Error:   "self-service registration is turned off",
 		})
 		return
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
-		"iat":      time.Now().Unix(),
-	})
+	var req models.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+
+	var problems []string
+	for _, problem := range auth.ValidateUsername(req.Username, h.Cfg.Registration.UsernameMinLength, h.Cfg.Registration.UsernameMaxLength) {
+		problems = append(problems, "username "+problem)
+	}
+	for _, problem := range h.PasswordPolicy.Validate(req.Password, req.Username) {
+		problems = append(problems, "password "+problem)
+	}
 
-	tokenString, err := token.SignedString([]byte(h.Cfg.JWTSecret))
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid username or password",
+			Error:   strings.Join(problems, "; "),
+		})
+		return
+	}
+
+	organization := h.Cfg.Tenancy.DefaultOrganization
+	if requested := strings.TrimSpace(req.Organization); requested != "" && requested != organization {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Registration is not open for this organization",
+			Error:   "only the default organization accepts registrations, ask an administrator of '" + requested + "' for an account",
+		})
+		return
+	}
+
+	organizationID, err := organizationIDBySlug(h.DB, organization)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to generate token",
+			Message: "Database error",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Login successful",
-		Data: models.LoginResponse{
-			Token: tokenString,
-			User:  user,
-		},
-	})
-}
-
-// SeedAdmin creates default admin user if not exists
-func (h *UserHandler) SeedAdmin(c *gin.Context) {
-	// Check if admin user already exists
-	var count int
-	checkQuery := `SELECT COUNT(*) FROM users WHERE username = 'admin'`
-	err := h.DB.QueryRow(checkQuery).Scan(&count)
-	
+	var taken bool
+	err = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))", req.Username).Scan(&taken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -124,18 +222,22 @@ func (h *UserHandler) SeedAdmin(c *gin.Context) {
 		})
 		return
 	}
-	
-	if count > 0 {
-		c.JSON(http.StatusOK, models.APIResponse{
-			Success: true,
-			Message: "Admin user already exists",
-			Data:    gin.H{"username": "admin"},
+
+	if taken {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Username already taken",
+			Error:   "a user with this username already exists",
 		})
 		return
 	}
-	
-	// Hash password "admin123"
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
+
+	email := normalizeEmail(req.Email)
+	if respondIfEmailTaken(c, h.DB, email, 0) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -144,55 +246,108 @@ func (h *UserHandler) SeedAdmin(c *gin.Context) {
 		})
 		return
 	}
-	
-	// Insert admin user
-	insertQuery := `INSERT INTO users (username, password, created_by) VALUES ($1, $2, $3)`
-	_, err = h.DB.Exec(insertQuery, "admin", string(hashedPassword), "system")
-	
+
+	status := "active"
+	if h.Cfg.Registration.RequireApproval {
+		status = "pending"
+	}
+
+	var user models.User
+	err = scanUser(h.DB.QueryRow(`
+		INSERT INTO users (username, email, password, status, organization_id, created_by, modified_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		RETURNING `+userColumns,
+		req.Username, email, string(hashedPassword), status, organizationID, "self-registration"), &user)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Username or email already taken",
+			Error:   "a user with this username or email already exists",
+		})
+		return
+	}
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to create admin user",
+			Message: "Failed to create user",
 			Error:   err.Error(),
 		})
 		return
 	}
-	
+
+	message := "Registration successful"
+	if status == "pending" {
+		message = "Registration successful, the account is awaiting approval"
+	}
+
 	c.JSON(http.StatusCreated, models.APIResponse{
 		Success: true,
-		Message: "Admin user created successfully",
-		Data:    gin.H{"username": "admin", "password": "admin123"},
+		Message: message,
+		Data:    user,
 	})
 }
 
-// ResetAdminPassword resets admin password to "admin123"
-func (h *UserHandler) ResetAdminPassword(c *gin.Context) {
-	// Hash password "admin123"
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
+// normalizeEmail trims email and returns nil for an empty address
+func normalizeEmail(email string) *string {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+	return &email
+}
+
+// respondIfEmailTaken writes a 409 response when another user already has
+// email, compared case-insensitively. It reports whether a response was
+// written.
+func respondIfEmailTaken(c *gin.Context, db *sql.DB, email *string, excludeID int) bool {
+	if email == nil {
+		return false
+	}
+
+	var taken bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)", *email, excludeID).Scan(&taken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to hash password",
+			Message: "Database error",
 			Error:   err.Error(),
 		})
-		return
+		return true
 	}
-	
-	// Update admin user password
-	_, err = h.DB.Exec(`UPDATE users SET password = $1, modified_at = CURRENT_TIMESTAMP WHERE username = 'admin'`, string(hashedPassword))
-	
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+
+	if taken {
+		c.JSON(http.StatusConflict, models.APIResponse{
 			Success: false,
-			Message: "Failed to reset admin password",
-			Error:   err.Error(),
+			Message: "Email already taken",
+			Error:   "a user with this email already exists",
 		})
-		return
+		return true
 	}
-	
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Admin password reset successfully",
-		Data:    gin.H{"username": "admin", "password": "admin123"},
-	})
-}
\ No newline at end of file
+	return false
+}
+
+// respondIfInactive writes a 403 response when user may not log in because
+// the account is pending or disabled. It reports whether a response was
+// written.
+func respondIfInactive(c *gin.Context, user *models.User) bool {
+	if user.Status == "pending" {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Account awaiting approval",
+			Error:   "an administrator has to approve this account before it can be used",
+		})
+		return true
+	}
+
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Account disabled",
+			Error:   "this account has been disabled",
+		})
+		return true
+	}
+	return false
+}
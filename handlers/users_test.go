@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"book-management-api/auth"
+	"book-management-api/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegisterRefusesOtherOrganizations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, fake := newFakeDB(t)
+
+	cfg := &config.Config{}
+	cfg.Registration.Enabled = true
+	cfg.Registration.UsernameMinLength = 3
+	cfg.Registration.UsernameMaxLength = 32
+	cfg.Tenancy.DefaultOrganization = "default"
+
+	policy, err := auth.NewPasswordPolicy(8, false, false, false, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewUserHandler(db, cfg, policy, nil, nil)
+
+	router := gin.New()
+	router.POST("/api/users/register", h.Register)
+
+	body := `{"username": "jane.doe", "password": "Correct-Horse-42", "organization": "riverside"}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users/register", strings.NewReader(body)))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", w.Code, w.Body)
+	}
+	if calls := fake.calls(""); len(calls) != 0 {
+		t.Errorf("ran %d statements, want none", len(calls))
+	}
+}
@@ -0,0 +1,120 @@
+package mail
+
+import (
+	"book-management-api/config"
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// smtpStub accepts one SMTP session and records its commands and message
+type smtpStub struct {
+	listener net.Listener
+	commands chan []string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	stub := &smtpStub{listener: listener, commands: make(chan []string, 1)}
+	go stub.serve()
+	return stub
+}
+
+func (s *smtpStub) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var commands []string
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		commands = append(commands, line)
+
+		switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); {
+		case verb == "EHLO" || verb == "HELO":
+			reply("250 stub")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:<") && strings.Count(line, "<") == 1:
+			reply("250 ok")
+		case verb == "MAIL":
+			reply("501 malformed address")
+		case verb == "RCPT":
+			reply("250 ok")
+		case verb == "DATA":
+			reply("354 go ahead")
+			for {
+				data, err := r.ReadString('\n')
+				if err != nil || data == ".\r\n" {
+					break
+				}
+				commands = append(commands, strings.TrimRight(data, "\r\n"))
+			}
+			reply("250 queued")
+		case verb == "QUIT":
+			reply("221 bye")
+			s.commands <- commands
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+	s.commands <- commands
+}
+
+func TestSMTPMailerSendsBareEnvelopeSender(t *testing.T) {
+	stub := newSMTPStub(t)
+	host, port, _ := net.SplitHostPort(stub.listener.Addr().String())
+
+	cfg := &config.Config{}
+	cfg.Mail.Driver = "smtp"
+	cfg.Mail.From = "Book Management <no-reply@localhost>"
+	cfg.Mail.SMTPHost = host
+	cfg.Mail.SMTPPort, _ = strconv.Atoi(port)
+
+	mailer, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mailer.Send(Message{To: "jane@example.com", Subject: "Hello", Body: "Hi Jane"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	commands := strings.Join(<-stub.commands, "\n")
+	if !strings.Contains(commands, "MAIL FROM:<no-reply@localhost>") {
+		t.Errorf("envelope sender is not the bare address:\n%s", commands)
+	}
+	if !strings.Contains(commands, "From: Book Management <no-reply@localhost>") {
+		t.Errorf("From header lost the display name:\n%s", commands)
+	}
+}
+
+func TestNewRefusesInvalidFrom(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Mail.Driver = "file"
+	cfg.Mail.From = "Book Management no-reply"
+	cfg.Mail.FilePath = t.TempDir() + "/outbox.eml"
+
+	if _, err := New(cfg); err == nil {
+		t.Fatal("New accepted an invalid MAIL_FROM")
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"book-management-api/auth"
+	"book-management-api/cli"
 	"book-management-api/config"
 	"book-management-api/database"
+	"book-management-api/mail"
+	"book-management-api/oidc"
 	"book-management-api/routes"
+	"book-management-api/storage"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,11 +27,88 @@ func main() {
 	}
 	defer db.Close()
 
+	// The admin connection works across organizations, so it must not be
+	// subject to row-level security. The API's connection should be.
+	adminDB, err := database.Connect(cfg.AdminDatabaseURL)
+	if err != nil {
+		log.Fatal("Failed to connect to database with ADMIN_DATABASE_URL:", err)
+	}
+	defer adminDB.Close()
+
+	if bypass, err := database.BypassesRowLevelSecurity(adminDB); err != nil {
+		log.Fatal("Failed to check database role:", err)
+	} else if !bypass {
+		log.Fatal("ADMIN_DATABASE_URL must connect as a superuser or a role with BYPASSRLS")
+	}
+	if bypass, err := database.BypassesRowLevelSecurity(db); err != nil {
+		log.Fatal("Failed to check database role:", err)
+	} else if bypass {
+		log.Println("Warning: DATABASE_URL connects as a role that bypasses row-level security, organizations are only separated by the queries")
+	}
+
 	// Run database migrations
-	if err := database.RunMigrations(cfg.DatabaseURL); err != nil {
+	if err := database.RunMigrations(cfg.AdminDatabaseURL); err != nil {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// Initialize password policy for new passwords
+	passwordPolicy, err := auth.NewPasswordPolicy(
+		cfg.PasswordPolicy.MinLength,
+		cfg.PasswordPolicy.RequireUpper,
+		cfg.PasswordPolicy.RequireLower,
+		cfg.PasswordPolicy.RequireDigit,
+		cfg.PasswordPolicy.RequireSymbol,
+		cfg.PasswordPolicy.BreachedListPath,
+	)
+	if err != nil {
+		log.Fatal("Failed to load password policy:", err)
+	}
+
+	// Run a command line subcommand instead of the server, e.g. "admin create"
+	if len(os.Args) > 1 {
+		if os.Args[1] != "admin" {
+			log.Fatalf("Unknown command %q, the only command is \"admin\"", os.Args[1])
+		}
+		if err := cli.Admin(adminDB, cfg, passwordPolicy, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Initialize file storage
+	store, err := storage.NewLocalStorage(cfg.Storage.Path)
+	if err != nil {
+		log.Fatal("Failed to initialize file storage:", err)
+	}
+
+	// Initialize access token signing keys and rotate them in the background
+	keys, err := auth.NewKeyStore(adminDB, cfg.Tokens.Algorithm, cfg.JWTSecret, cfg.Tokens.KeyEncryptionKey, cfg.Tokens.KeyRotation, cfg.Tokens.KeyGracePeriod)
+	if err != nil {
+		log.Fatal("Failed to initialize signing keys:", err)
+	}
+	go keys.RunRotation(time.Hour)
+
+	// Initialize mail delivery
+	mailer, err := mail.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+
+	// Initialize OpenID Connect login, if configured
+	var oidcProvider *oidc.Provider
+	if cfg.OIDC.Enabled {
+		if cfg.OIDC.IssuerURL == "" || cfg.OIDC.ClientID == "" {
+			log.Fatal("OIDC_ISSUER_URL and OIDC_CLIENT_ID are required when OIDC_ENABLED is set")
+		}
+		oidcProvider = oidc.NewProvider(oidc.Config{
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		}, nil)
+	}
+
 	// Initialize Gin router
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -34,7 +117,7 @@ func main() {
 	router := gin.Default()
 
 	// Setup routes
-	routes.SetupRoutes(router, db, cfg)
+	routes.SetupRoutes(router, db, adminDB, cfg, store, passwordPolicy, mailer, oidcProvider, keys)
 
 	// Get port from environment variable or use default
 	port := os.Getenv("PORT")
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"book-management-api/auth"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// APIKeyAuthenticator authenticates with an X-API-Key header. The key's
+// owner becomes the user of the request, with the key's scopes as
+// permissions, limited to what the owner's role currently grants.
+type APIKeyAuthenticator struct {
+	DB *sql.DB
+}
+
+func (a *APIKeyAuthenticator) Credentials() string {
+	return "an X-API-Key header"
+}
+
+func (a *APIKeyAuthenticator) Authenticate(c *gin.Context) (*Identity, error) {
+	key := c.GetHeader("X-API-Key")
+	if key == "" {
+		return nil, nil
+	}
+
+	var (
+		keyID, userID     int
+		organizationID    int
+		scopes, rolePerms []string
+		expiresAt         *time.Time
+		revoked           bool
+		username, role    string
+		status            string
+	)
+	err := a.DB.QueryRow(`
+		SELECT k.id, k.user_id, k.scopes, k.expires_at, k.revoked_at IS NOT NULL,
+			   u.username, u.role, u.status, u.organization_id,
+			   ARRAY(SELECT permission_name FROM role_permissions WHERE role_name = u.role)
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1
+	`, auth.HashToken(key)).Scan(&keyID, &userID, pq.Array(&scopes), &expiresAt, &revoked,
+		&username, &role, &status, &organizationID, pq.Array(&rolePerms))
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, &AuthError{Status: http.StatusInternalServerError, Message: "Failed to verify API key", Reason: err.Error()}
+	}
+
+	if err == sql.ErrNoRows || revoked || status != "active" || (expiresAt != nil && time.Now().After(*expiresAt)) {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Message: "Invalid API key", Reason: "API key is unknown, revoked or expired"}
+	}
+
+	granted := map[string]bool{}
+	for _, permission := range rolePerms {
+		granted[permission] = true
+	}
+	permissions := []string{}
+	for _, scope := range scopes {
+		if granted[scope] {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	if _, err := a.DB.Exec("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1", keyID); err != nil {
+		return nil, &AuthError{Status: http.StatusInternalServerError, Message: "Failed to verify API key", Reason: err.Error()}
+	}
+
+	return &Identity{
+		UserID:         userID,
+		Username:       username,
+		Role:           role,
+		Permissions:    permissions,
+		OrganizationID: organizationID,
+		APIKeyID:       keyID,
+	}, nil
+}
@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"book-management-api/auth"
+	"book-management-api/config"
+	"book-management-api/models"
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authenticator checks the credentials of one authentication scheme
+type Authenticator interface {
+	// Authenticate returns the identity of the request, or nil and no error
+	// when the request carries no credentials for this scheme. Rejected
+	// credentials are reported as an *AuthError.
+	Authenticate(c *gin.Context) (*Identity, error)
+
+	// Credentials names what the scheme expects in error messages, e.g.
+	// "a Bearer token"
+	Credentials() string
+}
+
+// challenger is implemented by authenticators that send a WWW-Authenticate
+// header when a request is rejected
+type challenger interface {
+	Challenge() string
+}
+
+// Identity is the user a request was authenticated as
+type Identity struct {
+	UserID      int
+	Username    string
+	Role        string
+	Permissions []string
+
+	// The tenant whose data the request may see
+	OrganizationID int
+
+	// Only set for JWTs
+	JTI       string
+	SessionID string
+	ExpiresAt time.Time
+
+	// Only set for API keys
+	APIKeyID int
+}
+
+// AuthError is a rejected authentication attempt. Status 500 means the
+// credentials could not be checked.
+type AuthError struct {
+	Status     int
+	Message    string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *AuthError) Error() string {
+	return e.Reason
+}
+
+// LoginGuard applies the throttling and history of the login endpoint to
+// password checks elsewhere, such as Basic authentication
+type LoginGuard interface {
+	// LoginBlockedFor returns how much longer attempts for username from the
+	// request's client are refused
+	LoginBlockedFor(c *gin.Context, username string) (time.Duration, error)
+	LoginSucceeded(c *gin.Context, username string) error
+	// LoginFailed records and throttles an attempt with wrong credentials;
+	// userID is 0 for unknown usernames
+	LoginFailed(c *gin.Context, userID int, username, reason string) error
+	// LoginRejected records an attempt with a correct password that was
+	// refused, e.g. for a disabled account
+	LoginRejected(c *gin.Context, userID int, username, reason string)
+}
+
+// NewAuthenticators returns the available authenticators by the names used
+// in the AUTH_* settings
+func NewAuthenticators(cfg *config.Config, db *sql.DB, keys *auth.KeyStore, guard LoginGuard) map[string]Authenticator {
+	return map[string]Authenticator{
+		"jwt":     &JWTAuthenticator{Cfg: cfg, DB: db, Keys: keys},
+		"api_key": &APIKeyAuthenticator{DB: db},
+		"basic":   &BasicAuthenticator{DB: db, Guard: guard},
+	}
+}
+
+// Authenticate lets a request through when one of authenticators accepts
+// it, trying them in order. Requests without any credentials, or whose
+// credentials every authenticator rejected, get a 401 (or the first
+// rejection's status). The identity is stored in the context as user_id,
+// username, role, permissions and organization_id, plus jti, session_id and
+// token_expires_at for JWTs and api_key_id for API keys.
+func Authenticate(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rejection *AuthError
+		for _, authenticator := range authenticators {
+			identity, err := authenticator.Authenticate(c)
+			if err != nil {
+				authErr, ok := err.(*AuthError)
+				if !ok {
+					authErr = &AuthError{Status: http.StatusInternalServerError, Message: "Failed to verify credentials", Reason: err.Error()}
+				}
+				if authErr.Status >= http.StatusInternalServerError {
+					respondAuthError(c, authErr)
+					return
+				}
+				if rejection == nil {
+					rejection = authErr
+				}
+				continue
+			}
+
+			if identity != nil {
+				setIdentity(c, identity)
+				c.Next()
+				return
+			}
+		}
+
+		for _, authenticator := range authenticators {
+			if challenger, ok := authenticator.(challenger); ok {
+				c.Header("WWW-Authenticate", challenger.Challenge())
+			}
+		}
+
+		if rejection == nil {
+			credentials := make([]string, 0, len(authenticators))
+			for _, authenticator := range authenticators {
+				credentials = append(credentials, authenticator.Credentials())
+			}
+			rejection = &AuthError{
+				Status:  http.StatusUnauthorized,
+				Message: "Authentication required",
+				Reason:  "missing credentials, send " + strings.Join(credentials, " or "),
+			}
+		}
+
+		respondAuthError(c, rejection)
+	}
+}
+
+func setIdentity(c *gin.Context, identity *Identity) {
+	c.Set("user_id", identity.UserID)
+	c.Set("username", identity.Username)
+	c.Set("role", identity.Role)
+	c.Set("permissions", identity.Permissions)
+	c.Set("organization_id", identity.OrganizationID)
+
+	if identity.JTI != "" {
+		c.Set("jti", identity.JTI)
+		c.Set("session_id", identity.SessionID)
+		c.Set("token_expires_at", identity.ExpiresAt)
+	}
+	if identity.APIKeyID != 0 {
+		c.Set("api_key_id", identity.APIKeyID)
+	}
+}
+
+func respondAuthError(c *gin.Context, err *AuthError) {
+	if err.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	}
+
+	c.JSON(err.Status, models.APIResponse{
+		Success: false,
+		Message: err.Message,
+		Error:   err.Reason,
+	})
+	c.Abort()
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"book-management-api/auth"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuthenticator authenticates with HTTP Basic credentials of an account
+// in the users table, for clients that cannot obtain tokens. Failed attempts
+// count towards the login throttling. Accounts with two-factor
+// authentication cannot use it, since a password alone would bypass the
+// second factor.
+type BasicAuthenticator struct {
+	DB    *sql.DB
+	Guard LoginGuard
+}
+
+func (a *BasicAuthenticator) Credentials() string {
+	return "Basic credentials"
+}
+
+func (a *BasicAuthenticator) Challenge() string {
+	return `Basic realm="book-management-api", charset="UTF-8"`
+}
+
+func (a *BasicAuthenticator) Authenticate(c *gin.Context) (*Identity, error) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+
+	remaining, err := a.Guard.LoginBlockedFor(c, username)
+	if err != nil {
+		return nil, &AuthError{Status: http.StatusInternalServerError, Message: "Failed to verify credentials", Reason: err.Error()}
+	}
+	if remaining > 0 {
+		return nil, &AuthError{
+			Status:     http.StatusTooManyRequests,
+			Message:    "Too many login attempts",
+			Reason:     "too many failed attempts, try again later",
+			RetryAfter: remaining,
+		}
+	}
+
+	var (
+		identity   Identity
+		hash       string
+		status     string
+		mfaEnabled bool
+	)
+	err = a.DB.QueryRow(`
+		SELECT u.id, u.username, u.role, u.organization_id, u.password, u.status,
+			   EXISTS(SELECT 1 FROM user_totp WHERE user_id = u.id AND enabled_at IS NOT NULL)
+			   OR COALESCE((SELECT require_mfa FROM roles WHERE name = u.role), FALSE),
+			   ARRAY(SELECT permission_name FROM role_permissions WHERE role_name = u.role ORDER BY permission_name)
+		FROM users u
+		WHERE u.username = $1
+	`, username).Scan(&identity.UserID, &identity.Username, &identity.Role, &identity.OrganizationID, &hash, &status, &mfaEnabled,
+		pq.Array(&identity.Permissions))
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, &AuthError{Status: http.StatusInternalServerError, Message: "Failed to verify credentials", Reason: err.Error()}
+	}
+
+	invalid := &AuthError{Status: http.StatusUnauthorized, Message: "Invalid credentials", Reason: "invalid username or password"}
+
+	if err == sql.ErrNoRows {
+		auth.CompareDummyPassword(password)
+		return nil, a.failed(c, 0, username, "unknown_user", invalid)
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, a.failed(c, identity.UserID, username, "wrong_password", invalid)
+	}
+
+	if status != "active" {
+		return nil, a.rejected(c, identity.UserID, username, "account_"+status, &AuthError{
+			Status:  http.StatusForbidden,
+			Message: "Account not active",
+			Reason:  "this account is pending approval or disabled",
+		})
+	}
+
+	if mfaEnabled {
+		return nil, a.rejected(c, identity.UserID, username, "mfa_required", &AuthError{
+			Status:  http.StatusUnauthorized,
+			Message: "Two-factor authentication required",
+			Reason:  "accounts with two-factor authentication must log in for a token",
+		})
+	}
+
+	if err := a.Guard.LoginSucceeded(c, username); err != nil {
+		return nil, &AuthError{Status: http.StatusInternalServerError, Message: "Failed to verify credentials", Reason: err.Error()}
+	}
+
+	return &identity, nil
+}
+
+// failed records an attempt with wrong credentials and returns rejection
+func (a *BasicAuthenticator) failed(c *gin.Context, userID int, username, reason string, rejection *AuthError) error {
+	if err := a.Guard.LoginFailed(c, userID, username, reason); err != nil {
+		return &AuthError{Status: http.StatusInternalServerError, Message: "Failed to verify credentials", Reason: err.Error()}
+	}
+	return rejection
+}
+
+// rejected records an attempt with a correct password that is refused anyway
+// and returns rejection
+func (a *BasicAuthenticator) rejected(c *gin.Context, userID int, username, reason string, rejection *AuthError) error {
+	a.Guard.LoginRejected(c, userID, username, reason)
+	return rejection
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"book-management-api/models"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PublicOrganization scopes unauthenticated requests to the organization
+// named by the organization query parameter, a slug, or to the organization
+// defaultSlug. The ID is stored in the context as organization_id.
+func PublicOrganization(db *sql.DB, defaultSlug string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		slug := c.DefaultQuery("organization", defaultSlug)
+
+		var organizationID int
+		err := db.QueryRow("SELECT id FROM organizations WHERE slug = $1", slug).Scan(&organizationID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Success: false,
+				Message: "Organization not found",
+				Error:   "no organization with the slug '" + slug + "' exists",
+			})
+			c.Abort()
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to fetch organization",
+				Error:   err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("organization_id", organizationID)
+		c.Next()
+	}
+}
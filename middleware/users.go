@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"book-management-api/auth"
 	"book-management-api/config"
 	"book-management-api/models"
+	"database/sql"
 	"net/http"
 	"strings"
 
@@ -10,63 +12,171 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func BasicAuth(cfg *config.Config) gin.HandlerFunc {
-	return gin.BasicAuth(gin.Accounts{
-		cfg.BasicAuth.Username: cfg.BasicAuth.Password,
-	})
+// JWTAuth only accepts bearer tokens, see JWTAuthenticator
+func JWTAuth(cfg *config.Config, db *sql.DB, keys *auth.KeyStore) gin.HandlerFunc {
+	return Authenticate(&JWTAuthenticator{Cfg: cfg, DB: db, Keys: keys})
 }
 
-func JWTAuth(cfg *config.Config) gin.HandlerFunc {
+// JWTAuthenticator validates bearer tokens and checks that they have not been
+// revoked: the jti must not be on the revocation list, the session must not
+// have been revoked, the token version must match the user's and the user
+// must still be active and belong to the organization in the org_id claim.
+// The signing key is chosen by the token's kid and the issuer and audience
+// must match the configuration.
+type JWTAuthenticator struct {
+	Cfg  *config.Config
+	DB   *sql.DB
+	Keys *auth.KeyStore
+}
+
+func (a *JWTAuthenticator) Credentials() string {
+	return "a Bearer token"
+}
+
+func (a *JWTAuthenticator) Authenticate(c *gin.Context) (*Identity, error) {
+	// Other schemes, such as Basic, are left to other authenticators
+	authHeader := c.GetHeader("Authorization")
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if authHeader == "" || tokenString == authHeader {
+		return nil, nil
+	}
+
+	// Parse and validate token
+	token, err := jwt.Parse(tokenString, a.Keys.Keyfunc,
+		jwt.WithValidMethods(a.Keys.Algorithms()),
+		jwt.WithIssuer(a.Cfg.Tokens.Issuer),
+		jwt.WithAudience(a.Cfg.Tokens.Audience),
+		jwt.WithExpirationRequired(),
+	)
+
+	if err != nil || !token.Valid {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Message: "Invalid token", Reason: err.Error()}
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	userID, _ := claims["user_id"].(float64)
+	tokenVersion, _ := claims["tv"].(float64)
+	jti, _ := claims["jti"].(string)
+	sessionID, _ := claims["sid"].(string)
+	organizationID, _ := claims["org_id"].(float64)
+
+	var (
+		currentVersion int
+		status         string
+		revoked        bool
+	)
+	err = a.DB.QueryRow(`
+		SELECT token_version, status,
+			   EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $2)
+			   OR EXISTS(SELECT 1 FROM refresh_tokens WHERE family_id = $3 AND revoked_at IS NOT NULL)
+		FROM users
+		WHERE id = $1 AND organization_id = $4
+	`, int(userID), jti, sessionID, int(organizationID)).Scan(&currentVersion, &status, &revoked)
+
+	if err != nil && err != sql.ErrNoRows {
+		return nil, &AuthError{Status: http.StatusInternalServerError, Message: "Failed to verify token", Reason: err.Error()}
+	}
+
+	if err == sql.ErrNoRows || jti == "" || revoked || status != "active" || int(tokenVersion) != currentVersion {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Message: "Invalid token", Reason: "token has been revoked"}
+	}
+
+	// Extract user information from token claims
+	identity := &Identity{
+		UserID:         int(userID),
+		Permissions:    permissionsFromClaims(claims),
+		OrganizationID: int(organizationID),
+		JTI:            jti,
+		SessionID:      sessionID,
+	}
+	identity.Username, _ = claims["username"].(string)
+	identity.Role, _ = claims["role"].(string)
+	if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+		identity.ExpiresAt = expiresAt.Time
+	}
+
+	return identity, nil
+}
+
+// RequireRole only lets requests through whose token carries one of roles. It
+// must run after JWTAuth.
+func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, models.APIResponse{
-				Success: false,
-				Message: "Authorization header required",
-				Error:   "missing authorization header",
-			})
-			c.Abort()
-			return
+		role, _ := c.Get("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
 		}
 
-		// Check if header starts with "Bearer "
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, models.APIResponse{
-				Success: false,
-				Message: "Invalid authorization header format",
-				Error:   "authorization header must start with 'Bearer '",
-			})
-			c.Abort()
-			return
-		}
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Insufficient permissions",
+			Error:   "this action requires one of the roles: " + strings.Join(roles, ", "),
+		})
+		c.Abort()
+	}
+}
 
-		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+// RequirePermission only lets requests through whose token grants
+// permission, e.g. "books:delete". It must run after JWTAuth.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permissions, _ := c.Get("permissions")
+		granted, _ := permissions.([]string)
+		for _, p := range granted {
+			if p == permission {
+				c.Next()
+				return
 			}
-			return []byte(cfg.JWTSecret), nil
+		}
+
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Insufficient permissions",
+			Error:   "this action requires the permission: " + permission,
 		})
+		c.Abort()
+	}
+}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, models.APIResponse{
-				Success: false,
-				Message: "Invalid token",
-				Error:   err.Error(),
-			})
-			c.Abort()
-			return
+// RequireAnyPermission lets requests through whose token grants at least one
+// of permissions. Routes whose handlers apply the ownership policy use it, as
+// owners need fewer permissions than other users.
+func RequireAnyPermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("permissions")
+		granted, _ := value.([]string)
+		for _, p := range granted {
+			for _, permission := range permissions {
+				if p == permission {
+					c.Next()
+					return
+				}
+			}
 		}
 
-		// Extract user information from token claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", claims["user_id"])
-			c.Set("username", claims["username"])
-		}
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Insufficient permissions",
+			Error:   "this action requires one of the permissions: " + strings.Join(permissions, ", "),
+		})
+		c.Abort()
+	}
+}
 
-		c.Next()
+// permissionsFromClaims reads the permissions claim, which is decoded as a
+// list of interface values
+func permissionsFromClaims(claims jwt.MapClaims) []string {
+	values, _ := claims["permissions"].([]interface{})
+	permissions := make([]string, 0, len(values))
+	for _, value := range values {
+		if permission, ok := value.(string); ok {
+			permissions = append(permissions, permission)
+		}
 	}
+	return permissions
 }
 
 // CORS middleware
@@ -1,26 +1,168 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type User struct {
-	ID         int       `json:"id" db:"id"`
-	Username   string    `json:"username" db:"username"`
-	Password   string    `json:"-" db:"password"` // Don't include in JSON responses
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	CreatedBy  *string   `json:"created_by" db:"created_by"`
+	ID                 int        `json:"id" db:"id"`
+	Username           string     `json:"username" db:"username"`
+	Email              *string    `json:"email" db:"email"`
+	Password           string     `json:"-" db:"password"` // Don't include in JSON responses
+	Role               string     `json:"role" db:"role"`
+	Status             string     `json:"status" db:"status"`
+	MustChangePassword bool       `json:"must_change_password" db:"must_change_password"`
+	TokenVersion       int        `json:"-" db:"token_version"`
+	OrganizationID     int        `json:"organization_id" db:"organization_id"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy          *string    `json:"created_by" db:"created_by"`
+	ModifiedAt         *time.Time `json:"modified_at" db:"modified_at"`
+	ModifiedBy         *string    `json:"modified_by" db:"modified_by"`
+}
+
+// Organization is a tenant, such as a library branch, with its own users
+// and catalog
+type Organization struct {
+	ID         int        `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	Slug       string     `json:"slug" db:"slug"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy  *string    `json:"created_by" db:"created_by"`
 	ModifiedAt *time.Time `json:"modified_at" db:"modified_at"`
-	ModifiedBy *string   `json:"modified_by" db:"modified_by"`
+	ModifiedBy *string    `json:"modified_by" db:"modified_by"`
+
+	// Only filled when requested with ?with=stats
+	Stats *OrganizationStats `json:"stats,omitempty"`
+}
+
+type OrganizationStats struct {
+	UserCount     int `json:"user_count"`
+	CategoryCount int `json:"category_count"`
+	BookCount     int `json:"book_count"`
+}
+
+// OrganizationInput creates or renames an organization. Without a slug a new
+// organization derives one from its name and a renamed one keeps its slug.
+type OrganizationInput struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug"`
+}
+
+type Role struct {
+	Name        string   `json:"name" db:"name"`
+	Description string   `json:"description" db:"description"`
+	Permissions []string `json:"permissions"`
+	RequireMFA  bool     `json:"require_mfa" db:"require_mfa"`
+}
+
+// RoleMFAInput turns the two-factor requirement of a role on or off
+type RoleMFAInput struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+// APIKey never contains the key itself, which is only returned on creation
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"key_prefix"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy  *string    `json:"created_by" db:"created_by"`
+}
+
+type APIKeyCreateInput struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyCreateResponse struct {
+	APIKey
+	Key string `json:"key"`
 }
 
 type Category struct {
 	ID         int        `json:"id" db:"id"`
 	Name       string     `json:"name" db:"name" binding:"required"`
+	Slug       string     `json:"slug" db:"slug"`
+	ParentID   *int       `json:"parent_id" db:"parent_id"`
+	Position   int        `json:"position" db:"position"`
+	IsVisible  bool       `json:"is_visible" db:"is_visible"`
 	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
 	CreatedBy  *string    `json:"created_by" db:"created_by"`
 	ModifiedAt *time.Time `json:"modified_at" db:"modified_at"`
 	ModifiedBy *string    `json:"modified_by" db:"modified_by"`
+
+	// The owner, who may edit and delete the category
+	CreatedByUserID *int `json:"created_by_user_id" db:"created_by_user_id"`
+
+	// For tree responses
+	Children []*Category `json:"children,omitempty"`
+
+	// Only filled when requested with ?with=stats
+	Stats *CategoryStats `json:"stats,omitempty"`
+}
+
+type CategoryStats struct {
+	BookCount         int                  `json:"book_count"`
+	AveragePrice      *float64             `json:"average_price"`
+	NewestReleaseYear *int                 `json:"newest_release_year"`
+	LastModifiedBook  *CategoryBookSummary `json:"last_modified_book"`
+}
+
+type CategoryBookSummary struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	ModifiedAt *time.Time `json:"modified_at"`
+}
+
+type CategoryUpdateInput struct {
+	Name      *string     `json:"name" binding:"omitempty,max=255"`
+	ParentID  NullableInt `json:"parent_id"`
+	IsVisible *bool       `json:"is_visible"`
+}
+
+type CategoryOrderInput struct {
+	CategoryIDs []int `json:"category_ids" binding:"required,min=1"`
+}
+
+type CategoryDeleteResult struct {
+	Mode                  string `json:"mode"`
+	AffectedBooks         int    `json:"affected_books"`
+	AffectedSubcategories int    `json:"affected_subcategories"`
+	TargetCategoryID      *int   `json:"target_category_id,omitempty"`
+}
+
+type CategoryMergeInput struct {
+	TargetCategoryID int `json:"target_category_id" binding:"required"`
+}
+
+type CategoryMergeResult struct {
+	SourceCategoryID   int `json:"source_category_id"`
+	TargetCategoryID   int `json:"target_category_id"`
+	MovedBooks         int `json:"moved_books"`
+	MovedSubcategories int `json:"moved_subcategories"`
+}
+
+// NullableInt tells a JSON field that is absent apart from one explicitly set
+// to null, which matters for partial updates
+type NullableInt struct {
+	Set   bool
+	Value *int
+}
+
+func (n *NullableInt) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &n.Value)
 }
 
 type Book struct {
@@ -37,6 +179,9 @@ type Book struct {
 	CreatedBy   *string    `json:"created_by" db:"created_by"`
 	ModifiedAt  *time.Time `json:"modified_at" db:"modified_at"`
 	ModifiedBy  *string    `json:"modified_by" db:"modified_by"`
+
+	// The owner, who may edit and delete the book
+	CreatedByUserID *int `json:"created_by_user_id" db:"created_by_user_id"`
 	
 	// For joined queries
 	CategoryName string `json:"category_name,omitempty" db:"category_name"`
@@ -52,14 +197,273 @@ type BookInput struct {
 	CategoryID  *int   `json:"category_id"`
 }
 
+// OwnershipTransferInput hands a book or category over to another user
+type OwnershipTransferInput struct {
+	UserID int `json:"user_id" binding:"required"`
+}
+
+type OwnershipTransferResult struct {
+	PreviousOwnerID *int   `json:"previous_owner_id"`
+	OwnerID         int    `json:"owner_id"`
+	OwnerUsername   string `json:"owner_username"`
+}
+
+type BookFile struct {
+	ID          int        `json:"id" db:"id"`
+	BookID      int        `json:"book_id" db:"book_id"`
+	Format      string     `json:"format" db:"format"`
+	FileName    string     `json:"file_name" db:"file_name"`
+	ContentType string     `json:"content_type" db:"content_type"`
+	SizeBytes   int64      `json:"size_bytes" db:"size_bytes"`
+	SHA256      string     `json:"sha256" db:"sha256"`
+	StorageKey  string     `json:"-" db:"storage_key"` // Internal location in the storage backend
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy   *string    `json:"created_by" db:"created_by"`
+	ModifiedAt  *time.Time `json:"modified_at" db:"modified_at"`
+	ModifiedBy  *string    `json:"modified_by" db:"modified_by"`
+}
+
+type ReadingList struct {
+	ID          int               `json:"id" db:"id"`
+	UserID      int               `json:"user_id" db:"user_id"`
+	Name        string            `json:"name" db:"name"`
+	Description *string           `json:"description" db:"description"`
+	Kind        string            `json:"kind" db:"kind"`
+	Visibility  string            `json:"visibility" db:"visibility"`
+	ShareToken  string            `json:"share_token,omitempty" db:"share_token"`
+	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
+	CreatedBy   *string           `json:"created_by" db:"created_by"`
+	ModifiedAt  *time.Time        `json:"modified_at" db:"modified_at"`
+	ModifiedBy  *string           `json:"modified_by" db:"modified_by"`
+	Items       []ReadingListItem `json:"items,omitempty"`
+}
+
+type ReadingListItem struct {
+	ID         int        `json:"id" db:"id"`
+	ListID     int        `json:"list_id" db:"list_id"`
+	BookID     int        `json:"book_id" db:"book_id"`
+	Position   int        `json:"position" db:"position"`
+	Note       *string    `json:"note" db:"note"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy  *string    `json:"created_by" db:"created_by"`
+	ModifiedAt *time.Time `json:"modified_at" db:"modified_at"`
+	ModifiedBy *string    `json:"modified_by" db:"modified_by"`
+
+	// For joined queries
+	BookTitle string `json:"book_title,omitempty" db:"book_title"`
+}
+
+type ReadingListInput struct {
+	Name        string  `json:"name" binding:"required,max=255"`
+	Description *string `json:"description"`
+	Kind        string  `json:"kind" binding:"omitempty,oneof=reading wishlist"`
+	Visibility  string  `json:"visibility" binding:"omitempty,oneof=private unlisted public"`
+}
+
+type ReadingListItemInput struct {
+	BookID int     `json:"book_id" binding:"required"`
+	Note   *string `json:"note"`
+}
+
+type ReadingListItemUpdateInput struct {
+	Note *string `json:"note"`
+}
+
+type ReadingListOrderInput struct {
+	BookIDs []int `json:"book_ids" binding:"required"`
+}
+
+type ReadingProgress struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	BookID      int        `json:"book_id" db:"book_id"`
+	CurrentPage int        `json:"current_page" db:"current_page"`
+	Percentage  float64    `json:"percentage" db:"percentage"`
+	Status      string     `json:"status" db:"status"`
+	StartedAt   time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at" db:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	CreatedBy   *string    `json:"created_by" db:"created_by"`
+	ModifiedAt  *time.Time `json:"modified_at" db:"modified_at"`
+	ModifiedBy  *string    `json:"modified_by" db:"modified_by"`
+
+	// For joined queries
+	BookTitle string `json:"book_title,omitempty" db:"book_title"`
+	TotalPage int    `json:"total_page,omitempty" db:"total_page"`
+}
+
+type ReadingProgressInput struct {
+	CurrentPage *int     `json:"current_page" binding:"omitempty,min=0"`
+	Percentage  *float64 `json:"percentage" binding:"omitempty,min=0,max=100"`
+	Finished    *bool    `json:"finished"`
+	StartedAt   *string  `json:"started_at" binding:"omitempty,datetime=2006-01-02"`
+	FinishedAt  *string  `json:"finished_at" binding:"omitempty,datetime=2006-01-02"`
+}
+
+type ReadingYearSummary struct {
+	Year      int `json:"year"`
+	BooksRead int `json:"books_read"`
+	PagesRead int `json:"pages_read"`
+}
+
+type ReadingOverview struct {
+	InProgress []ReadingProgress    `json:"in_progress"`
+	Finished   []ReadingProgress    `json:"finished"`
+	Yearly     []ReadingYearSummary `json:"yearly"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"omitempty,email"`
+	Password string `json:"password" binding:"required"`
+	// Slug of the organization to join. Only the default organization is
+	// accepted; the field may be left out.
+	Organization string `json:"organization"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ForgotPasswordRequest identifies the account by username or email
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type AdminUserCreateInput struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"omitempty,email"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
+	// Only accepted from super administrators; defaults to the caller's
+	// organization
+	OrganizationID *int `json:"organization_id"`
+}
+
+type AdminUserUpdateInput struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+	Role     *string `json:"role"`
+}
+
+type AdminPasswordResetInput struct {
+	Password string `json:"password"`
+}
+
+type AdminPasswordResetResponse struct {
+	User              User   `json:"user"`
+	TemporaryPassword string `json:"temporary_password,omitempty"`
+}
+
+type PaginatedResponse struct {
+	Items    interface{} `json:"items"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+	Total    int         `json:"total"`
+}
+
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string   `json:"token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int      `json:"expires_in"`
+	User         User     `json:"user"`
+	Permissions  []string `json:"permissions"`
+	SessionID    string   `json:"session_id"`
+	// Only set when the login completed a two-factor enrolment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when a second
+// factor is needed. EnrollmentRequired means the user's role requires
+// two-factor authentication but the user has not set it up yet.
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	MFAToken           string `json:"mfa_token"`
+	ExpiresIn          int    `json:"expires_in"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+// MFAVerifyRequest completes a login with a TOTP code or a recovery code
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// TOTPEnrollment holds a new TOTP secret, its otpauth URI and the URI as a
+// QR code for authenticator apps to scan
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// Session is a login together with the refreshes that followed it
+type Session struct {
+	ID           string    `json:"id"`
+	StartedAt    time.Time `json:"started_at"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	UserAgent    *string   `json:"user_agent"`
+	IPAddress    *string   `json:"ip_address"`
+	Current      bool      `json:"current"`
+}
+
+// LoginEvent records a login attempt. UserID is nil for unknown usernames
+// and FailureReason is nil for successful logins.
+type LoginEvent struct {
+	ID            int       `json:"id" db:"id"`
+	UserID        *int      `json:"user_id" db:"user_id"`
+	Username      string    `json:"username" db:"username"`
+	Method        string    `json:"method" db:"method"`
+	Success       bool      `json:"success" db:"success"`
+	FailureReason *string   `json:"failure_reason" db:"failure_reason"`
+	SessionID     *string   `json:"session_id" db:"session_id"`
+	IPAddress     *string   `json:"ip_address" db:"ip_address"`
+	UserAgent     *string   `json:"user_agent" db:"user_agent"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type APIResponse struct {
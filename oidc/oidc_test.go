@@ -0,0 +1,216 @@
+package oidc_test
+
+import (
+	"book-management-api/oidc"
+	"book-management-api/oidc/oidctest"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const clientID = "book-api"
+
+func newProvider(idp *oidctest.Provider) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		IssuerURL:   idp.Issuer(),
+		ClientID:    clientID,
+		RedirectURL: "http://localhost:8080/api/users/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	}, nil)
+}
+
+// login runs the flow up to the token exchange and returns the ID token
+func login(t *testing.T, idp *oidctest.Provider, p *oidc.Provider, nonce string) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	verifier := "verifier-" + strings.Repeat("x", 40)
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, _, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return p.Exchange(ctx, code, verifier)
+}
+
+func TestAuthCodeURLUsesDiscovery(t *testing.T) {
+	idp := oidctest.NewProvider(clientID)
+	defer idp.Close()
+
+	authURL, err := newProvider(idp).AuthCodeURL(context.Background(), "state-1", "nonce-1", "challenge-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse %q: %v", authURL, err)
+	}
+	if got, want := u.Scheme+"://"+u.Host+u.Path, idp.URL+"/authorize"; got != want {
+		t.Errorf("authorization endpoint = %q, want %q", got, want)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+	}
+	for name, value := range want {
+		if got := u.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewProvider(clientID)
+	defer idp.Close()
+	idp.DiscoveryIssuer = "https://evil.example.com"
+
+	if _, err := newProvider(idp).AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatal("discovery with another issuer was accepted")
+	}
+}
+
+func TestExchangeAndVerify(t *testing.T) {
+	idp := oidctest.NewProvider(clientID)
+	defer idp.Close()
+	p := newProvider(idp)
+
+	rawIDToken, err := login(t, idp, p, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	claims, err := p.VerifyIDToken(context.Background(), rawIDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims["sub"] != "subject-1" {
+		t.Errorf("sub = %v, want subject-1", claims["sub"])
+	}
+}
+
+func TestExchangeRequiresCodeVerifier(t *testing.T) {
+	idp := oidctest.NewProvider(clientID)
+	defer idp.Close()
+	p := newProvider(idp)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", oidc.CodeChallenge("right-verifier"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, _, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	if _, err := p.Exchange(ctx, code, "wrong-verifier"); err == nil {
+		t.Fatal("exchange with the wrong code verifier succeeded")
+	}
+	if _, err := p.Exchange(ctx, code, "right-verifier"); err == nil {
+		t.Fatal("code could be redeemed a second time")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		nonce  string
+	}{
+		{name: "wrong nonce", nonce: "other-nonce"},
+		{name: "missing nonce", claims: map[string]interface{}{"nonce": ""}},
+		{name: "other audience", claims: map[string]interface{}{"aud": "other-client"}},
+		{name: "other issuer", claims: map[string]interface{}{"iss": "https://evil.example.com"}},
+		{name: "expired", claims: map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "no subject", claims: map[string]interface{}{"sub": ""}},
+		{name: "several audiences without azp", claims: map[string]interface{}{"aud": []string{clientID, "other-client"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := oidctest.NewProvider(clientID)
+			defer idp.Close()
+			for name, value := range tt.claims {
+				idp.Claims[name] = value
+			}
+			p := newProvider(idp)
+
+			rawIDToken, err := login(t, idp, p, "nonce-1")
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			nonce := "nonce-1"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			if _, err := p.VerifyIDToken(context.Background(), rawIDToken, nonce); err == nil {
+				t.Fatal("ID token was accepted")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignKey(t *testing.T) {
+	idp := oidctest.NewProvider(clientID)
+	defer idp.Close()
+	other := oidctest.NewProvider(clientID)
+	defer other.Close()
+	p := newProvider(idp)
+
+	// Signed by another provider's key but otherwise valid for idp
+	other.Claims["iss"] = idp.Issuer()
+	rawIDToken, err := other.IDToken("subject-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("IDToken: %v", err)
+	}
+
+	if _, err := p.VerifyIDToken(context.Background(), rawIDToken, "nonce-1"); err == nil {
+		t.Fatal("ID token signed with an unknown key was accepted")
+	}
+}
+
+func TestJWKSIsCachedAndRefetchThrottled(t *testing.T) {
+	idp := oidctest.NewProvider(clientID)
+	defer idp.Close()
+	p := newProvider(idp)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		rawIDToken, err := idp.IDToken("subject-1", "nonce-1")
+		if err != nil {
+			t.Fatalf("IDToken: %v", err)
+		}
+		if _, err := p.VerifyIDToken(ctx, rawIDToken, "nonce-1"); err != nil {
+			t.Fatalf("VerifyIDToken: %v", err)
+		}
+	}
+	if got := idp.JWKSRequests(); got != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", got)
+	}
+
+	// Within the refetch interval an unknown key does not trigger a fetch
+	idp.RotateKey()
+	rawIDToken, err := idp.IDToken("subject-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("IDToken: %v", err)
+	}
+	if _, err := p.VerifyIDToken(ctx, rawIDToken, "nonce-1"); err == nil {
+		t.Fatal("token with a rotated key was accepted before the JWKS was refetched")
+	}
+	if got := idp.JWKSRequests(); got != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", got)
+	}
+}
@@ -1,17 +1,24 @@
 package routes
 
 import (
+	"book-management-api/auth"
 	"book-management-api/config"
 	"book-management-api/handlers"
+	"book-management-api/mail"
 	"book-management-api/middleware"
 	"book-management-api/models"
+	"book-management-api/oidc"
+	"book-management-api/storage"
 	"database/sql"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config) {
+// SetupRoutes registers all routes. Handlers of organization data use db,
+// whose role is subject to row-level security; accounts, organizations and
+// authentication use adminDB, which spans organizations.
+func SetupRoutes(router *gin.Engine, db, adminDB *sql.DB, cfg *config.Config, store storage.Storage, passwordPolicy *auth.PasswordPolicy, mailer mail.Mailer, oidcProvider *oidc.Provider, keys *auth.KeyStore) {
 	// Set trusted proxies (only localhost for development)
 	router.SetTrustedProxies([]string{"127.0.0.1", "::1"})
 	
@@ -31,9 +38,38 @@ func SetupRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config) {
 	})
 
 	// Initialize handlers
-	userHandler := handlers.NewUserHandler(db, cfg)
+	userHandler := handlers.NewUserHandler(adminDB, cfg, passwordPolicy, mailer, keys)
+	adminUserHandler := handlers.NewAdminUserHandler(adminDB, cfg, passwordPolicy)
 	categoryHandler := handlers.NewCategoryHandler(db)
-	bookHandler := handlers.NewBookHandler(db)
+	publicCategoryHandler := handlers.NewPublicCategoryHandler(db)
+	bookHandler := handlers.NewBookHandler(db, store)
+	bookFileHandler := handlers.NewBookFileHandler(db, store, cfg)
+	readingListHandler := handlers.NewReadingListHandler(db, adminDB)
+	readingProgressHandler := handlers.NewReadingProgressHandler(db)
+	roleHandler := handlers.NewRoleHandler(adminDB)
+	organizationHandler := handlers.NewOrganizationHandler(adminDB, cfg)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db)
+	jwksHandler := handlers.NewJWKSHandler(keys)
+
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", jwksHandler.Get)
+
+	// Shorthands for the permission guards below. Routes guarded by canAny
+	// apply the ownership policy: owners of a record only need the create
+	// permission to edit or delete it.
+	can := middleware.RequirePermission
+	canAny := middleware.RequireAnyPermission
+
+	// authenticate accepts any of the named authenticators, tried in order.
+	// The names come from the AUTH_* settings, which config.Load validates.
+	authenticators := middleware.NewAuthenticators(cfg, adminDB, keys, userHandler)
+	authenticate := func(names []string) gin.HandlerFunc {
+		chain := make([]middleware.Authenticator, 0, len(names))
+		for _, name := range names {
+			chain = append(chain, authenticators[name])
+		}
+		return middleware.Authenticate(chain...)
+	}
 
 	// API routes
 	api := router.Group("/api")
@@ -42,55 +78,143 @@ func SetupRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config) {
 		users := api.Group("/users")
 		{
 			users.POST("/login", userHandler.Login)
-			users.POST("/seed-admin", userHandler.SeedAdmin) // Temporary endpoint to create admin user
-			users.POST("/reset-admin-password", userHandler.ResetAdminPassword) // Temporary endpoint to reset admin password
+			users.POST("/register", userHandler.Register)
+			users.POST("/refresh", userHandler.Refresh)
+			users.POST("/forgot-password", userHandler.ForgotPassword)
+			users.POST("/reset-password", userHandler.ResetPassword)
+			users.POST("/mfa/verify", userHandler.VerifyMFA)
+			users.POST("/mfa/enroll", userHandler.EnrollMFA)
+
+			// Login through the OpenID provider, when configured
+			if oidcProvider != nil {
+				oidcHandler := handlers.NewOIDCHandler(adminDB, cfg, oidcProvider, userHandler)
+				users.GET("/oidc/login", oidcHandler.Login)
+				users.GET("/oidc/callback", oidcHandler.Callback)
+			}
+			// Logout revokes the token itself, so it only accepts JWTs
+			users.POST("/logout", middleware.JWTAuth(cfg, adminDB, keys), userHandler.Logout)
+			users.POST("/logout-all", middleware.JWTAuth(cfg, adminDB, keys), userHandler.LogoutAll)
+
+			// Routes for the authenticated user
+			me := users.Group("/me")
+			me.Use(authenticate(cfg.Auth.Me))
+			{
+				me.GET("/reading", can("reading:write"), readingProgressHandler.GetMine)
+				me.POST("/password", userHandler.ChangePassword)
+				me.GET("/api-keys", apiKeyHandler.GetAll)
+				me.POST("/api-keys", apiKeyHandler.Create)
+				me.DELETE("/api-keys/:id", apiKeyHandler.Revoke)
+				me.GET("/sessions", userHandler.GetSessions)
+				me.DELETE("/sessions/:session_id", userHandler.RevokeSession)
+				me.GET("/mfa", userHandler.GetMFAStatus)
+				me.POST("/mfa/totp", userHandler.EnrollTOTP)
+				me.POST("/mfa/totp/confirm", userHandler.ConfirmTOTP)
+				me.DELETE("/mfa/totp", userHandler.DisableTOTP)
+				me.POST("/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+			}
 		}
 
-		// Category routes with JWT authentication
+		// Administration routes, only for admins
+		admin := api.Group("/admin")
+		admin.Use(authenticate(cfg.Auth.Admin), can("users:manage"))
+		{
+			admin.GET("/roles", roleHandler.GetAll)
+			// Roles are shared by all organizations
+			admin.PUT("/roles/:name/mfa", can("organizations:manage"), roleHandler.SetMFARequirement)
+			admin.GET("/organizations", can("organizations:manage"), organizationHandler.GetAll)
+			admin.POST("/organizations", can("organizations:manage"), organizationHandler.Create)
+			admin.GET("/organizations/:id", can("organizations:manage"), organizationHandler.GetByID)
+			admin.PUT("/organizations/:id", can("organizations:manage"), organizationHandler.Update)
+			admin.DELETE("/organizations/:id", can("organizations:manage"), organizationHandler.Delete)
+			admin.GET("/users", adminUserHandler.GetAll)
+			admin.POST("/users", adminUserHandler.Create)
+			admin.GET("/users/pending", adminUserHandler.GetPending)
+			admin.GET("/users/:id", adminUserHandler.GetByID)
+			admin.PUT("/users/:id", adminUserHandler.Update)
+			admin.PATCH("/users/:id", adminUserHandler.Update)
+			admin.DELETE("/users/:id", adminUserHandler.Delete)
+			admin.POST("/users/:id/approve", adminUserHandler.Approve)
+			admin.POST("/users/:id/reject", adminUserHandler.Reject)
+			admin.POST("/users/:id/disable", adminUserHandler.Disable)
+			admin.POST("/users/:id/enable", adminUserHandler.Enable)
+			admin.POST("/users/:id/reset-password", adminUserHandler.ResetPassword)
+			admin.POST("/users/:id/unlock", adminUserHandler.Unlock)
+			admin.DELETE("/users/:id/mfa", adminUserHandler.ResetMFA)
+			admin.GET("/users/:id/logins", adminUserHandler.GetLogins)
+			admin.GET("/users/:id/sessions", adminUserHandler.GetSessions)
+			admin.DELETE("/users/:id/sessions/:session_id", adminUserHandler.RevokeSession)
+		}
+
+		// Category routes with the authenticators of AUTH_CATEGORIES
 		categories := api.Group("/categories")
-		categories.Use(middleware.JWTAuth(cfg)) // Use JWT authentication
+		categories.Use(authenticate(cfg.Auth.Categories))
 		{
-			categories.GET("", categoryHandler.GetAll)
-			categories.POST("", categoryHandler.Create)
-			categories.GET("/:id", categoryHandler.GetByID)
-			categories.DELETE("/:id", categoryHandler.Delete)
-			categories.GET("/:id/books", categoryHandler.GetBooksByCategory)
+			categories.GET("", can("categories:read"), categoryHandler.GetAll)
+			categories.POST("", can("categories:create"), categoryHandler.Create)
+			categories.GET("/tree", can("categories:read"), categoryHandler.GetTree)
+			categories.PUT("/order", can("categories:update"), categoryHandler.Reorder)
+			categories.GET("/:id", can("categories:read"), categoryHandler.GetByID)
+			categories.PUT("/:id", canAny("categories:update", "categories:create"), categoryHandler.Update)
+			categories.PATCH("/:id", canAny("categories:update", "categories:create"), categoryHandler.Update)
+			categories.DELETE("/:id", canAny("categories:delete", "categories:create"), categoryHandler.Delete)
+			categories.GET("/:id/books", can("categories:read"), categoryHandler.GetBooksByCategory)
+			categories.POST("/:id/merge", canAny("categories:delete", "categories:create"), categoryHandler.Merge)
+			categories.PUT("/:id/owner", canAny("categories:delete", "categories:create"), categoryHandler.TransferOwnership)
 		}
 
-		// Book routes with JWT authentication
+		// Book routes with the authenticators of AUTH_BOOKS
 		books := api.Group("/books")
-		books.Use(middleware.JWTAuth(cfg)) // Use JWT authentication
+		books.Use(authenticate(cfg.Auth.Books))
 		{
-			books.GET("", bookHandler.GetAll)
-			books.POST("", bookHandler.Create)
-			books.GET("/:id", bookHandler.GetByID)
-			books.DELETE("/:id", bookHandler.Delete)
+			books.GET("", can("books:read"), bookHandler.GetAll)
+			books.POST("", can("books:create"), bookHandler.Create)
+			books.GET("/:id", can("books:read"), bookHandler.GetByID)
+			books.PUT("/:id", canAny("books:update", "books:create"), bookHandler.Update)
+			books.DELETE("/:id", canAny("books:delete", "books:create"), bookHandler.Delete)
+			books.PUT("/:id/owner", canAny("books:delete", "books:create"), bookHandler.TransferOwnership)
+			books.GET("/:id/files", can("books:read"), bookFileHandler.GetAll)
+			books.POST("/:id/files", canAny("books:update", "books:create"), bookFileHandler.Upload)
+			books.GET("/:id/files/:fileId", can("books:read"), bookFileHandler.Download)
+			books.DELETE("/:id/files/:fileId", canAny("books:delete", "books:create"), bookFileHandler.Delete)
+			books.GET("/:id/progress", can("reading:write"), readingProgressHandler.Get)
+			books.PUT("/:id/progress", can("reading:write"), readingProgressHandler.Upsert)
+			books.DELETE("/:id/progress", can("reading:write"), readingProgressHandler.Delete)
 		}
-	}
 
-	// Alternative routes with Basic Auth (comment out JWT routes above and uncomment these if you prefer Basic Auth)
-	/*
-	// Category routes with Basic Authentication
-	categories := api.Group("/categories")
-	categories.Use(middleware.BasicAuth(cfg))
-	{
-		categories.GET("", categoryHandler.GetAll)
-		categories.POST("", categoryHandler.Create)
-		categories.GET("/:id", categoryHandler.GetByID)
-		categories.DELETE("/:id", categoryHandler.Delete)
-		categories.GET("/:id/books", categoryHandler.GetBooksByCategory)
-	}
+		// Reading list routes with the authenticators of AUTH_LISTS
+		lists := api.Group("/lists")
+		lists.Use(authenticate(cfg.Auth.Lists))
+		{
+			lists.GET("", can("reading:write"), readingListHandler.GetAll)
+			lists.POST("", can("reading:write"), readingListHandler.Create)
+			lists.GET("/:id", can("reading:write"), readingListHandler.GetByID)
+			lists.PUT("/:id", can("reading:write"), readingListHandler.Update)
+			lists.DELETE("/:id", can("reading:write"), readingListHandler.Delete)
+			lists.POST("/:id/share-token", can("reading:write"), readingListHandler.RegenerateShareToken)
+			lists.PUT("/:id/order", can("reading:write"), readingListHandler.Reorder)
+			lists.POST("/:id/items", can("reading:write"), readingListHandler.AddItem)
+			lists.PUT("/:id/items/:bookId", can("reading:write"), readingListHandler.UpdateItem)
+			lists.DELETE("/:id/items/:bookId", can("reading:write"), readingListHandler.RemoveItem)
+		}
 
-	// Book routes with Basic Authentication
-	books := api.Group("/books")
-	books.Use(middleware.BasicAuth(cfg))
-	{
-		books.GET("", bookHandler.GetAll)
-		books.POST("", bookHandler.Create)
-		books.GET("/:id", bookHandler.GetByID)
-		books.DELETE("/:id", bookHandler.Delete)
+		// Public storefront routes, only showing visible categories of the
+		// organization in ?organization, the default one without it
+		public := api.Group("/public")
+		public.Use(middleware.PublicOrganization(adminDB, cfg.Tenancy.DefaultOrganization))
+		{
+			public.GET("/categories", publicCategoryHandler.GetAll)
+			public.GET("/categories/tree", publicCategoryHandler.GetTree)
+			public.GET("/categories/:id", publicCategoryHandler.GetByID)
+			public.GET("/categories/:id/books", publicCategoryHandler.GetBooksByCategory)
+		}
+
+		// Shared reading lists, reachable without logging in
+		shared := api.Group("/shared")
+		{
+			shared.GET("/lists", middleware.PublicOrganization(adminDB, cfg.Tenancy.DefaultOrganization), readingListHandler.GetPublic)
+			shared.GET("/lists/:token", readingListHandler.GetShared)
+		}
 	}
-	*/
 
 	// 404 handler
 	router.NoRoute(func(c *gin.Context) {
@@ -0,0 +1,81 @@
+package slug
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Letters that do not decompose into a base letter plus combining marks
+var transliterations = map[rune]string{
+	'ß': "ss",
+	'æ': "ae",
+	'œ': "oe",
+	'ø': "o",
+	'đ': "d",
+	'ð': "d",
+	'ł': "l",
+	'þ': "th",
+	'ı': "i",
+}
+
+// Make turns s into a lowercase, URL-safe slug such as "science-fiction".
+// Accented letters are transliterated to ASCII and every run of other
+// characters becomes a single hyphen. The result may be empty.
+func Make(s string) string {
+	var b strings.Builder
+	pendingHyphen := false
+
+	for _, r := range norm.NFKD.String(strings.ToLower(s)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		var part string
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			part = string(r)
+		default:
+			part = transliterations[r]
+		}
+
+		if part == "" {
+			pendingHyphen = b.Len() > 0
+			continue
+		}
+
+		if pendingHyphen {
+			b.WriteByte('-')
+			pendingHyphen = false
+		}
+		b.WriteString(part)
+	}
+
+	return b.String()
+}
+
+// MakeOr is like Make, but returns fallback instead of an empty slug and
+// prefixes purely numeric slugs with fallback so they cannot be mistaken for
+// numeric IDs
+func MakeOr(s, fallback string) string {
+	base := Make(s)
+	if base == "" {
+		return fallback
+	}
+	if _, err := strconv.Atoi(base); err == nil {
+		return fallback + "-" + base
+	}
+	return base
+}
+
+// Unique returns base, or base with the lowest numeric suffix from 2 up that
+// is not taken
+func Unique(base string, taken map[string]bool) string {
+	candidate := base
+	for n := 2; taken[candidate]; n++ {
+		candidate = base + "-" + strconv.Itoa(n)
+	}
+	return candidate
+}